@@ -0,0 +1,122 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import "io"
+
+// Range is the byte range [Start, End) of a file.
+type Range struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// Result bundles everything a scan finds out about an archive.
+type Result struct {
+	Entries []FileHeader
+	// Gaps are the ranges not taken up by entries or the central
+	// directory, which may hide data.
+	Gaps []Range
+	// Segments are the archives concatenated in the file, each ending
+	// with an end of central directory record.
+	Segments []Range
+	// Central compares the entries with those archive/zip lists. It is nil
+	// if archive/zip can't open the archive.
+	Central *Reconciliation
+	Summary Summary
+}
+
+// Analyze scans the first size bytes of r like ScanReaderAt and bundles
+// the results with the layout of the file.
+func Analyze(r io.ReaderAt, size int64, opts ...Option) (*Result, error) {
+	cfg := newConfig(opts)
+	var c collector
+	var res Result
+	// The section keeps everything, including archive/zip, within size.
+	r = io.NewSectionReader(r, 0, size)
+	err := scanFileHeaders(newReadAhead(r, size, cfg.window()), cfg, &c, &res.Summary)
+	res.Entries = c.headers
+	if err != nil {
+		res.Summary.Reason, res.Summary.Error = reasonError, err.Error()
+		return &res, err
+	}
+	res.Summary.Reason = reasonEOF
+	if !res.Summary.foundZip() {
+		res.Summary.Reason = reasonNotZip
+	}
+	for _, g := range gaps(spansOf(res.Summary.regions), size) {
+		res.Gaps = append(res.Gaps, Range{g.start, g.end})
+	}
+	for _, seg := range archiveSegments(r, size) {
+		res.Segments = append(res.Segments, Range{seg.start, seg.end})
+	}
+	// Without a central directory there is nothing to compare with.
+	res.Central, _ = reconcile(c.headers, r, size)
+	return &res, nil
+}
+
+// jsonResult is the JSON representation of a Result.
+type jsonResult struct {
+	Entries  []*jsonEntry        `json:"entries"`
+	Gaps     []Range             `json:"gaps"`
+	Segments []Range             `json:"segments"`
+	Central  *jsonReconciliation `json:"central"`
+	Summary  *Summary            `json:"summary"`
+	Error    string              `json:"error,omitempty"`
+}
+
+// jsonReconciliation is the JSON representation of a Reconciliation. The
+// entries are in the entries of the result already, so they are only
+// named here by name and data offset.
+type jsonReconciliation struct {
+	Both        []entryRef `json:"both"`
+	ScannerOnly []entryRef `json:"scannerOnly"`
+	StdlibOnly  []entryRef `json:"stdlibOnly"`
+}
+
+// entryRef names an entry by its name and data offset, which is -1 if
+// archive/zip can't find the local header.
+type entryRef struct {
+	Name   string `json:"name"`
+	Offset int64  `json:"offset"`
+}
+
+func newJSONReconciliation(rec *Reconciliation) *jsonReconciliation {
+	refs := func(headers []FileHeader) []entryRef {
+		r := []entryRef{}
+		for _, h := range headers {
+			r = append(r, entryRef{h.name, h.pos})
+		}
+		return r
+	}
+	j := &jsonReconciliation{Both: refs(rec.Both), ScannerOnly: refs(rec.ScannerOnly), StdlibOnly: []entryRef{}}
+	for _, f := range rec.StdlibOnly {
+		j.StdlibOnly = append(j.StdlibOnly, entryRef{f.Name, f.Offset})
+	}
+	return j
+}
+
+func newJSONResult(res *Result, err error) *jsonResult {
+	j := &jsonResult{Entries: []*jsonEntry{}, Gaps: res.Gaps, Segments: res.Segments, Summary: &res.Summary}
+	for i := range res.Entries {
+		j.Entries = append(j.Entries, newJSONEntry(&res.Entries[i]))
+	}
+	if res.Central != nil {
+		j.Central = newJSONReconciliation(res.Central)
+	}
+	if err != nil {
+		j.Error = err.Error()
+	}
+	return j
+}
@@ -0,0 +1,46 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONResultIncludesCentral(t *testing.T) {
+	r := bytes.NewReader(mustBuildFixture(t, selftestFiles))
+	b, err := json.Marshal(newJSONResult(Analyze(r, r.Size())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Central *struct {
+			Both, ScannerOnly, StdlibOnly []entryRef
+		}
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Central == nil {
+		t.Fatalf("no central directory data in %s", b)
+	}
+	if len(got.Central.Both) != 2 || len(got.Central.StdlibOnly) != 0 {
+		t.Errorf("both %v, stdlib only %v, want 2 and none", got.Central.Both, got.Central.StdlibOnly)
+	}
+	if len(got.Central.ScannerOnly) != 1 || got.Central.ScannerOnly[0].Name != "payload.bin" {
+		t.Errorf("scanner only %v, want payload.bin", got.Central.ScannerOnly)
+	}
+}
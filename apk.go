@@ -0,0 +1,149 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// apkSigBlockMagic ends the APK Signing Block, which sits between the last
+// entry and the central directory of signed APKs and JARs. Zip parsers
+// skip it, so it is a place to hide data.
+const apkSigBlockMagic = "APK Sig Block 42"
+
+// signingBlockIDs names the IDs of the pairs in signing blocks that
+// Android tools write.
+var signingBlockIDs = map[uint32]string{
+	0x7109871a: "v2 signature",
+	0xf05368c0: "v3 signature",
+	0x1b93ad61: "v3.1 signature",
+	0x6dff800d: "source stamp",
+	0x2b09189e: "source stamp v1",
+	0x42726577: "verity padding",
+	0x504b4453: "dependency info",
+	0x2146444e: "play frosting",
+}
+
+// SigningBlock is an APK Signing Block.
+type SigningBlock struct {
+	// Offset and Size locate the whole block, up to the central
+	// directory.
+	Offset int64         `json:"offset"`
+	Size   int64         `json:"size"`
+	Pairs  []SigningPair `json:"pairs"`
+}
+
+// SigningPair is an ID-value pair in a signing block. Offset and Size
+// locate the value.
+type SigningPair struct {
+	ID     uint32 `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+}
+
+// readSigningBlock reads the signing block in front of the central
+// directory at cdPos, if there is one. Warnings point out malformed blocks
+// and unexpected IDs.
+func readSigningBlock(r io.ReaderAt, cdPos int64) (*SigningBlock, []string) {
+	// The block ends with its size and the magic.
+	var tail [24]byte
+	if cdPos < 32 {
+		return nil, nil
+	}
+	if _, err := r.ReadAt(tail[:], cdPos-24); err != nil || string(tail[8:]) != apkSigBlockMagic {
+		return nil, nil
+	}
+	size := binary.LittleEndian.Uint64(tail[:])
+	// The size excludes the leading size field itself.
+	if size < 24 || size > uint64(cdPos-8) {
+		return nil, []string{fmt.Sprintf("APK signing block before %d has impossible size %d", cdPos, size)}
+	}
+	b := &SigningBlock{Offset: cdPos - int64(size) - 8, Size: int64(size) + 8}
+	var warnings []string
+	var head [12]byte
+	if _, err := r.ReadAt(head[:8], b.Offset); err != nil {
+		return nil, nil
+	}
+	if first := binary.LittleEndian.Uint64(head[:]); first != size {
+		warnings = append(warnings, fmt.Sprintf("APK signing block at %d starts with size %d but ends with %d", b.Offset, first, size))
+	}
+	end := cdPos - 24
+	for pos := b.Offset + 8; pos < end; {
+		if end-pos < 12 {
+			warnings = append(warnings, fmt.Sprintf("APK signing block at %d has %d stray bytes at %d", b.Offset, end-pos, pos))
+			break
+		}
+		if _, err := r.ReadAt(head[:], pos); err != nil {
+			break
+		}
+		n := binary.LittleEndian.Uint64(head[:])
+		if n < 4 || n > uint64(end-pos-8) {
+			warnings = append(warnings, fmt.Sprintf("APK signing block pair at %d has impossible length %d", pos, n))
+			break
+		}
+		p := SigningPair{ID: binary.LittleEndian.Uint32(head[8:]), Offset: pos + 12, Size: int64(n) - 4}
+		p.Name = signingBlockIDs[p.ID]
+		if p.Name == "" {
+			warnings = append(warnings, fmt.Sprintf("APK signing block has unexpected ID %#08x with %d bytes at %d", p.ID, p.Size, p.Offset))
+		}
+		b.Pairs = append(b.Pairs, p)
+		pos += 8 + int64(n)
+	}
+	return b, warnings
+}
+
+// extractSigningBlock writes the values of the signing block of filename
+// to files in dir, named by their position in the block and ID.
+func extractSigningBlock(filename, dir string, cfg *config) error {
+	f, release, err := openInput(filename, cfg.spill)
+	if err != nil {
+		return err
+	}
+	defer release()
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	cd, err := readCentralDirectory(f, size)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	b, _ := readSigningBlock(f, cd.pos)
+	if b == nil {
+		return fmt.Errorf("%s: no APK signing block", filename)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for i, p := range b.Pairs {
+		out, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("%d-%08x.bin", i, p.ID)), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, io.NewSectionReader(f, p.Offset, p.Size)); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
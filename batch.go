@@ -0,0 +1,168 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readInputList reads the paths listed in filename, one per line, with "-"
+// meaning standard input.
+func readInputList(filename string) ([]string, error) {
+	r := io.Reader(os.Stdin)
+	if filename != "-" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var paths []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if p := strings.TrimSpace(s.Text()); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths, s.Err()
+}
+
+// expandDirs replaces the directories among files with the files below
+// them that look like zip archives, for -r. Other arguments are kept as
+// they are, for the scan to report any problems with them.
+func expandDirs(files []string) []string {
+	var out []string
+	for _, name := range files {
+		if fi, err := os.Stat(name); name == "-" || err != nil || !fi.IsDir() {
+			out = append(out, name)
+			continue
+		}
+		filepath.WalkDir(name, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// Unreadable directories are skipped, the rest is
+				// still worth scanning.
+				fmt.Fprintln(os.Stderr, err)
+				return nil
+			}
+			if d.Type().IsRegular() && fileLooksLikeZip(p) {
+				out = append(out, p)
+			}
+			return nil
+		})
+	}
+	return out
+}
+
+// fileLooksLikeZip applies looksLikeZip to the file p. Files that can't be
+// read are included, so the scan reports why.
+func fileLooksLikeZip(p string) bool {
+	f, err := os.Open(p)
+	if err != nil {
+		return true
+	}
+	defer f.Close()
+	var head [4]byte
+	n, _ := io.ReadFull(f, head[:])
+	return looksLikeZip(p, head[:n])
+}
+
+// scanFiles calls scan for every file and its index in files, running up to
+// jobs scans at the same time. The output of each scan is written to w as a
+// whole, in the order of files. Errors are printed to stderr and returned
+// in the order of files.
+func scanFiles(files []string, jobs int, w io.Writer, scan func(i int, filename string, w io.Writer) error) []error {
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs == 1 {
+		// Without concurrency, output can go straight through.
+		var errs []error
+		for i, filename := range files {
+			if err := scan(i, filename, w); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				errs = append(errs, err)
+			}
+		}
+		return errs
+	}
+
+	type result struct {
+		out  bytes.Buffer
+		err  error
+		done chan struct{}
+	}
+	results := make([]*result, len(files))
+	for i := range results {
+		results[i] = &result{done: make(chan struct{})}
+	}
+	next := make(chan int)
+	go func() {
+		for i := range files {
+			next <- i
+		}
+		close(next)
+	}()
+	for j := 0; j < jobs; j++ {
+		go func() {
+			for i := range next {
+				results[i].err = scan(i, files[i], &results[i].out)
+				close(results[i].done)
+			}
+		}()
+	}
+
+	var errs []error
+	for _, r := range results {
+		<-r.done
+		w.Write(r.out.Bytes())
+		if r.err != nil {
+			fmt.Fprintln(os.Stderr, r.err)
+			errs = append(errs, r.err)
+		}
+	}
+	return errs
+}
+
+// summarizeOpenErrors lists the files that couldn't be opened by category.
+func summarizeOpenErrors(errs []error, w io.Writer) {
+	var categories []string
+	byCategory := make(map[string][]string)
+	for _, err := range errs {
+		var oe *openError
+		if !errors.As(err, &oe) {
+			continue
+		}
+		if byCategory[oe.category] == nil {
+			categories = append(categories, oe.category)
+		}
+		byCategory[oe.category] = append(byCategory[oe.category], oe.filename)
+	}
+	if len(categories) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "files that could not be opened:")
+	for _, c := range categories {
+		fmt.Fprintf(w, "  %s (%d): %s\n", c, len(byCategory[c]), strings.Join(byCategory[c], ", "))
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import "strings"
+
+// generalFlags is the decoded general purpose bit flag of a local file header.
+type generalFlags struct {
+	Encrypted          bool `json:"encrypted"`
+	CompressionOptions int  `json:"compressionOptions"`
+	DataDescriptor     bool `json:"dataDescriptor"`
+	EnhancedDeflation  bool `json:"enhancedDeflation"`
+	StrongEncryption   bool `json:"strongEncryption"`
+	UTF8               bool `json:"utf8"`
+}
+
+func decodeFlags(flags uint16) generalFlags {
+	return generalFlags{
+		Encrypted:          flags&0x1 != 0,
+		CompressionOptions: int(flags>>1) & 0x3,
+		DataDescriptor:     flags&0x8 != 0,
+		EnhancedDeflation:  flags&0x10 != 0,
+		StrongEncryption:   flags&0x40 != 0,
+		UTF8:               flags&0x800 != 0,
+	}
+}
+
+// String lists the names of the set flags.
+func (f generalFlags) String() string {
+	var names []string
+	if f.Encrypted {
+		names = append(names, "encrypted")
+	}
+	switch f.CompressionOptions {
+	case 1:
+		names = append(names, "opt1")
+	case 2:
+		names = append(names, "opt2")
+	case 3:
+		names = append(names, "opt1,opt2")
+	}
+	if f.DataDescriptor {
+		names = append(names, "data-descriptor")
+	}
+	if f.EnhancedDeflation {
+		names = append(names, "enhanced-deflation")
+	}
+	if f.StrongEncryption {
+		names = append(names, "strong-encryption")
+	}
+	if f.UTF8 {
+		names = append(names, "utf8")
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// mapPrecedence orders the region kinds by which one a character of the
+// map shows when it covers several. Gaps come first, as they are what the
+// map is looking for, and small structures before large ones.
+const mapPrecedence = string(regionGap) + string(regionTrailing) + string(regionHeader) +
+	string(regionSigning) + string(regionCentral) + string(regionEOCD) + string(regionData)
+
+// mapLegend explains the characters of the map.
+const mapLegend = "h header  = entry data  C central directory  E end of central directory  S APK signing block  . gap  t trailing data"
+
+// mapReporter draws the regions of the file as a bar of width characters
+// once the scan is done, for -map.
+type mapReporter struct {
+	w     io.Writer
+	width int
+}
+
+// mapWidth is the width of the map for output to f: that of the terminal,
+// else $COLUMNS, else 80.
+func mapWidth(f *os.File) int {
+	if n := terminalWidth(f); n > 0 {
+		return n
+	}
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return 80
+}
+
+func (m *mapReporter) entry(h *FileHeader) error {
+	return nil
+}
+
+func (m *mapReporter) summary(s *Summary) error {
+	if s.Size == 0 {
+		_, err := fmt.Fprintln(m.w, "empty file")
+		return err
+	}
+	bar := drawMap(s.regions, s.Size, m.width-2)
+	_, err := fmt.Fprintf(m.w, "[%s]\n%.1f bytes per character: %s\n", bar, float64(s.Size)/float64(len(bar)), mapLegend)
+	return err
+}
+
+// drawMap renders regions and the gaps between them in a file of the
+// given size as width characters, each covering an equal share.
+func drawMap(regions []region, size int64, width int) string {
+	if width < 1 {
+		width = 1
+	}
+	if int64(width) > size {
+		width = int(size)
+	}
+	eocdEnd := size
+	for _, r := range regions {
+		if r.kind == regionEOCD {
+			eocdEnd = r.end
+		}
+	}
+	all := append([]region(nil), regions...)
+	for _, g := range gaps(spansOf(regions), size) {
+		kind := byte(regionGap)
+		if g.start >= eocdEnd {
+			kind = regionTrailing
+		}
+		all = append(all, region{g, kind})
+	}
+	// Each cell collects the kinds of the regions it touches.
+	cells := make([]map[byte]bool, width)
+	for _, r := range all {
+		if r.end <= r.start {
+			continue
+		}
+		first, last := r.start*int64(width)/size, (r.end-1)*int64(width)/size
+		for i := first; i <= last && i < int64(width); i++ {
+			if cells[i] == nil {
+				cells[i] = make(map[byte]bool)
+			}
+			cells[i][r.kind] = true
+		}
+	}
+	var b strings.Builder
+	for _, c := range cells {
+		for i := 0; i < len(mapPrecedence); i++ {
+			if c[mapPrecedence[i]] {
+				b.WriteByte(mapPrecedence[i])
+				break
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// canonicalReporter prints a deterministic text form for diffing: entries
+// sorted by offset, one per line with a fixed set of fields in a fixed
+// order, then a summary line. Times are in UTC, names quoted.
+type canonicalReporter struct {
+	w       io.Writer
+	entries []*FileHeader
+}
+
+func (c *canonicalReporter) entry(h *FileHeader) error {
+	e := *h
+	c.entries = append(c.entries, &e)
+	return nil
+}
+
+func (c *canonicalReporter) summary(s *Summary) error {
+	sort.SliceStable(c.entries, func(i, j int) bool {
+		a, b := c.entries[i], c.entries[j]
+		if a.pos != b.pos {
+			return a.pos < b.pos
+		}
+		return a.name < b.name
+	})
+	for _, h := range c.entries {
+		warnings := append([]string(nil), h.warnings...)
+		sort.Strings(warnings)
+		if _, err := fmt.Fprintf(c.w, "entry offset=%d header=%d name=%q method=%d flags=0x%04x version=%d csize=%d size=%d crc32=%08x modified=%s class=%s hidden=%t warnings=%q\n",
+			h.pos, h.headerPos(), h.name, h.compression, h.flags, h.version, h.csize, h.size, h.crc32,
+			h.modTime.UTC().Format(time.RFC3339), h.class, h.hidden, strings.Join(warnings, "; ")); err != nil {
+			return err
+		}
+	}
+	warnings := append([]string(nil), s.Warnings...)
+	sort.Strings(warnings)
+	_, err := fmt.Fprintf(c.w, "summary reason=%s error=%q entries=%d suppressed=%d hidden=%d phantom=%d size=%d accounted=%d warnings=%q\n",
+		s.Reason, s.Error, s.Entries, s.Suppressed, s.Hidden, s.Phantom, s.Size, s.Accounted, strings.Join(warnings, "; "))
+	return err
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// carvePlan writes carving instructions for external tools, one
+// "offset length name" line per entry, covering the local header, data
+// and data descriptor. Entries of nested scans are left out, as their
+// offsets refer to the content they were found in rather than the file. It
+// is safe for concurrent use.
+type carvePlan struct {
+	mu sync.Mutex
+	w  io.Writer
+	// multi adds a "# file" line before the entries of each file.
+	multi bool
+}
+
+// reporter returns a reporter that adds the entries of filename to the
+// plan once the scan is done, then passes them on to rep.
+func (p *carvePlan) reporter(rep reporter, filename string) reporter {
+	return &carveReporter{rep: rep, plan: p, file: filename}
+}
+
+type carveReporter struct {
+	rep  reporter
+	plan *carvePlan
+	file string
+	buf  bytes.Buffer
+}
+
+func (c *carveReporter) entry(h *FileHeader) error {
+	if len(h.containers) > 0 {
+		return c.rep.entry(h)
+	}
+	length := h.pos - h.headerPos() + int64(h.csize) + descriptorLen(h.src, h)
+	fmt.Fprintf(&c.buf, "%d %d %s\n", h.headerPos(), length, tskEscaper.Replace(h.name))
+	return c.rep.entry(h)
+}
+
+func (c *carveReporter) summary(s *Summary) error {
+	// Entries of a file stay together even with concurrent scans.
+	c.plan.mu.Lock()
+	var err error
+	if c.plan.multi {
+		_, err = fmt.Fprintf(c.plan.w, "# %s\n", c.file)
+	}
+	if err == nil {
+		_, err = c.plan.w.Write(c.buf.Bytes())
+	}
+	c.plan.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("carve plan: %w", err)
+	}
+	return c.rep.summary(s)
+}
@@ -0,0 +1,51 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestNestedOffsetsLeftOut checks that the carve plan and the TSK records,
+// which give file offsets, leave out entries of nested scans.
+func TestNestedOffsetsLeftOut(t *testing.T) {
+	top := &FileHeader{name: "inner.zip", pos: 40, csize: 100}
+	nested := &FileHeader{name: "a.txt", pos: 35, csize: 5}
+
+	var plan, tsk strings.Builder
+	p := &carvePlan{w: &plan}
+	collect := &collector{}
+	for _, rep := range []reporter{p.reporter(collect, "a.zip"), &tskReporter{w: &tsk}} {
+		if err := rep.entry(top); err != nil {
+			t.Fatal(err)
+		}
+		if err := (&prefixReporter{rep, "inner.zip"}).entry(nested); err != nil {
+			t.Fatal(err)
+		}
+		if err := rep.summary(&Summary{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := "10 130 inner.zip\n"; plan.String() != want {
+		t.Errorf("carve plan %q, want %q", plan.String(), want)
+	}
+	if lines := strings.Split(strings.TrimSpace(tsk.String()), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[1], "10\t130\tinner.zip\t") {
+		t.Errorf("TSK records:\n%s", tsk.String())
+	}
+	if len(collect.headers) != 2 {
+		t.Errorf("the carve plan passed on %d entries, want 2", len(collect.headers))
+	}
+}
@@ -0,0 +1,419 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	centralHeaderSignature   = 0x02014b50
+	endOfCentralDirSignature = 0x06054b50
+)
+
+// centralRecord is an entry in the central directory.
+type centralRecord struct {
+	versionMadeBy, versionNeeded, flags, compression, mtime, mdate uint16
+	crc32, csize, size                                             uint32
+	namelen, extralen, commentlen, diskStart, internalAttrs        uint16
+	externalAttrs, headerOffset                                    uint32
+	name                                                           string
+	extra, comment                                                 []byte
+
+	// headerPos is the position of the local header in the file, taking
+	// data prepended to the archive into account.
+	headerPos int64
+	// index is the position of the record in the central directory.
+	index int
+}
+
+// unixMode returns the Unix mode bits from the external attributes, if the
+// entry was made on Unix.
+func (c *centralRecord) unixMode() (uint32, bool) {
+	if c.versionMadeBy>>8 != 3 {
+		return 0, false
+	}
+	return c.externalAttrs >> 16, true
+}
+
+// centralDirectory is the central directory of an archive with its end
+// record.
+type centralDirectory struct {
+	// eocdPos is the position of the end of central directory record.
+	eocdPos int64
+	// pos and size locate the central directory records in the file.
+	pos, size int64
+	// base is the amount of data prepended to the archive, e.g. an SFX stub.
+	base    int64
+	records []*centralRecord
+	comment []byte
+
+	byHeaderPos map[int64]*centralRecord
+}
+
+// lookup returns the record pointing to the local header at pos.
+func (cd *centralDirectory) lookup(pos int64) *centralRecord {
+	if cd == nil {
+		return nil
+	}
+	return cd.byHeaderPos[pos]
+}
+
+// findEndOfCentralDir returns the position of the last end of central
+// directory record in the size bytes of r.
+func findEndOfCentralDir(r io.ReaderAt, size int64) (int64, error) {
+	// The record is 22 bytes followed by a comment of up to 64 KiB.
+	n := int64(22 + 0xffff)
+	if n > size {
+		n = size
+	}
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, size-n); err != nil && err != io.EOF {
+		return 0, err
+	}
+	for i := len(buf) - 22; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(buf[i:]) != endOfCentralDirSignature {
+			continue
+		}
+		commentlen := int(binary.LittleEndian.Uint16(buf[i+20:]))
+		if i+22+commentlen <= len(buf) {
+			return size - n + int64(i), nil
+		}
+	}
+	return 0, errors.New("no end of central directory record found")
+}
+
+// readCentralDirectory reads the central directory of the archive in the
+// size bytes of r.
+func readCentralDirectory(r io.ReaderAt, size int64) (*centralDirectory, error) {
+	eocdPos, err := findEndOfCentralDir(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return readCentralDirectoryAt(r, size, eocdPos)
+}
+
+// readCentralDirectoryAt reads the central directory belonging to the end
+// of central directory record at eocdPos.
+func readCentralDirectoryAt(r io.ReaderAt, size, eocdPos int64) (*centralDirectory, error) {
+	eocd := make([]byte, 22)
+	if _, err := r.ReadAt(eocd, eocdPos); err != nil {
+		return nil, err
+	}
+	cdSize := int64(binary.LittleEndian.Uint32(eocd[12:]))
+	cdOffset := int64(binary.LittleEndian.Uint32(eocd[16:]))
+	commentlen := int64(binary.LittleEndian.Uint16(eocd[20:]))
+	if cdOffset == 0xffffffff || cdSize == 0xffffffff {
+		return nil, errors.New("zip64 central directories are not supported")
+	}
+
+	cd := &centralDirectory{
+		eocdPos:     eocdPos,
+		size:        cdSize,
+		byHeaderPos: make(map[int64]*centralRecord),
+	}
+	cd.base = eocdPos - cdSize - cdOffset
+	if cd.base < 0 {
+		cd.base = 0
+	}
+	cd.pos = cd.base + cdOffset
+	if cd.pos+cdSize > size {
+		return nil, fmt.Errorf("central directory at %d len %d exceeds file size", cd.pos, cdSize)
+	}
+	if commentlen > 0 && eocdPos+22+commentlen <= size {
+		cd.comment = make([]byte, commentlen)
+		if _, err := r.ReadAt(cd.comment, eocdPos+22); err != nil {
+			return nil, err
+		}
+	}
+
+	buf := make([]byte, cdSize)
+	if _, err := r.ReadAt(buf, cd.pos); err != nil && cdSize > 0 {
+		return nil, err
+	}
+	for len(buf) >= 46 {
+		rec, n, err := parseCentralRecord(buf)
+		if err != nil {
+			return nil, fmt.Errorf("central directory record at %d: %w", cd.pos+cdSize-int64(len(buf)), err)
+		}
+		rec.headerPos = cd.base + int64(rec.headerOffset)
+		rec.index = len(cd.records)
+		cd.records = append(cd.records, rec)
+		cd.byHeaderPos[rec.headerPos] = rec
+		buf = buf[n:]
+	}
+	return cd, nil
+}
+
+// parseCentralRecord parses the record at the start of buf, returning its
+// total length.
+func parseCentralRecord(buf []byte) (*centralRecord, int, error) {
+	if binary.LittleEndian.Uint32(buf) != centralHeaderSignature {
+		return nil, 0, errors.New("invalid signature")
+	}
+	le := binary.LittleEndian
+	c := centralRecord{
+		versionMadeBy: le.Uint16(buf[4:]),
+		versionNeeded: le.Uint16(buf[6:]),
+		flags:         le.Uint16(buf[8:]),
+		compression:   le.Uint16(buf[10:]),
+		mtime:         le.Uint16(buf[12:]),
+		mdate:         le.Uint16(buf[14:]),
+		crc32:         le.Uint32(buf[16:]),
+		csize:         le.Uint32(buf[20:]),
+		size:          le.Uint32(buf[24:]),
+		namelen:       le.Uint16(buf[28:]),
+		extralen:      le.Uint16(buf[30:]),
+		commentlen:    le.Uint16(buf[32:]),
+		diskStart:     le.Uint16(buf[34:]),
+		internalAttrs: le.Uint16(buf[36:]),
+		externalAttrs: le.Uint32(buf[38:]),
+		headerOffset:  le.Uint32(buf[42:]),
+	}
+	n := 46 + int(c.namelen) + int(c.extralen) + int(c.commentlen)
+	if n > len(buf) {
+		return nil, 0, errors.New("record exceeds central directory")
+	}
+	c.name = string(buf[46 : 46+c.namelen])
+	c.extra = buf[46+c.namelen : 46+c.namelen+c.extralen]
+	c.comment = buf[46+c.namelen+c.extralen : n]
+	return &c, n, nil
+}
+
+// firstArchiveEnd returns the end of the first archive in r, i.e. the end
+// of the first end of central directory record that is preceded by its
+// central directory.
+func firstArchiveEnd(r io.ReaderAt, size int64) (int64, bool) {
+	sig := []byte{0x50, 0x4b, 0x05, 0x06}
+	buf := make([]byte, 64<<10)
+	for pos := int64(0); pos < size; pos += int64(len(buf) - len(sig) + 1) {
+		n, err := r.ReadAt(buf, pos)
+		if n == 0 && err != nil {
+			return 0, false
+		}
+		for i := 0; ; {
+			idx := bytes.Index(buf[i:n], sig)
+			if idx == -1 {
+				break
+			}
+			eocdPos := pos + int64(i+idx)
+			if end, ok := archiveEndAt(r, size, eocdPos); ok {
+				return end, true
+			}
+			i += idx + 1
+		}
+	}
+	return 0, false
+}
+
+// archiveEndAt checks the end of central directory record at eocdPos and
+// returns the position after it. The central directory must fit in front
+// of the record and agree with its entry count, so that a stray signature
+// in entry data isn't taken for the end of an archive.
+func archiveEndAt(r io.ReaderAt, size, eocdPos int64) (int64, bool) {
+	eocd := make([]byte, 22)
+	if _, err := r.ReadAt(eocd, eocdPos); err != nil {
+		return 0, false
+	}
+	entries := int64(binary.LittleEndian.Uint16(eocd[10:]))
+	cdSize := int64(binary.LittleEndian.Uint32(eocd[12:]))
+	end := eocdPos + 22 + int64(binary.LittleEndian.Uint16(eocd[20:]))
+	if end > size || cdSize > eocdPos {
+		return 0, false
+	}
+	// Every central directory record takes at least 46 bytes.
+	if (entries == 0) != (cdSize == 0) || cdSize < 46*entries {
+		return 0, false
+	}
+	if cdSize > 0 {
+		var sig [4]byte
+		if _, err := r.ReadAt(sig[:], eocdPos-cdSize); err != nil || binary.LittleEndian.Uint32(sig[:]) != centralHeaderSignature {
+			return 0, false
+		}
+	}
+	return end, true
+}
+
+// readLocalHeader parses the local file header at pos. Reading through
+// the seeker lets a read-ahead window serve consecutive headers.
+func readLocalHeader(r io.ReadSeeker, pos int64) (*FileHeader, error) {
+	if _, err := r.Seek(pos, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var buf [30]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(buf[:]) != fileHeaderSignature {
+		return nil, fmt.Errorf("no local file header at %d", pos)
+	}
+	var fields localHeaderFields
+	if err := binary.Read(bytes.NewReader(buf[4:]), binary.LittleEndian, &fields); err != nil {
+		return nil, fmt.Errorf("reading local file header: %w", err)
+	}
+	h := &FileHeader{
+		version: fields.Version, flags: fields.Flags, compression: fields.Compression,
+		mtime: fields.Mtime, mdate: fields.Mdate,
+		crc32: fields.CRC32, csize: fields.Csize, size: fields.Size,
+		namelen: fields.Namelen, extralen: fields.Extralen,
+	}
+	rest := make([]byte, int(h.namelen)+int(h.extralen))
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, err
+	}
+	h.name = string(rest[:h.namelen])
+	h.extra = rest[h.namelen:]
+	h.pos = pos + 30 + int64(len(rest))
+	return h, nil
+}
+
+// localHeaders returns a function that yields the local headers the
+// records point to in central directory order, then io.EOF. A missing
+// local header is filled in from its record, with a warning.
+func (cd *centralDirectory) localHeaders(r io.ReadSeeker) func() (*FileHeader, error) {
+	i := 0
+	return func() (*FileHeader, error) {
+		if i >= len(cd.records) {
+			return nil, io.EOF
+		}
+		rec := cd.records[i]
+		i++
+		h, err := readLocalHeader(r, rec.headerPos)
+		if err == nil {
+			return h, nil
+		}
+		return &FileHeader{
+			version: rec.versionNeeded, flags: rec.flags, compression: rec.compression,
+			mtime: rec.mtime, mdate: rec.mdate,
+			crc32: rec.crc32, csize: rec.csize, size: rec.size,
+			namelen: rec.namelen, name: rec.name,
+			pos:      rec.headerPos + 30 + int64(rec.namelen),
+			warnings: []string{"local header missing: " + err.Error()},
+		}, nil
+	}
+}
+
+// archiveSegments returns the byte ranges of the archives concatenated in
+// r. Each segment ends with a valid end of central directory record and
+// starts where the previous one ended.
+func archiveSegments(r io.ReaderAt, size int64) []span {
+	var segments []span
+	start := int64(0)
+	for start < size {
+		end, ok := firstArchiveEnd(io.NewSectionReader(r, start, size-start), size-start)
+		if !ok {
+			break
+		}
+		segments = append(segments, span{start, start + end})
+		start += end
+	}
+	return segments
+}
+
+// entryData is the data range of a found entry.
+type entryData struct {
+	name string
+	span
+}
+
+// checkSharedData warns about entries that reference the same compressed
+// data, so extractors see one file where there are two names: central
+// directory records pointing to the same local header, and entries whose
+// data is the tail of another's, ending at the same byte. Entries merely
+// nested in the data of another end elsewhere.
+func checkSharedData(cd *centralDirectory, entries []entryData) []string {
+	var warnings []string
+	if cd != nil {
+		first := make(map[int64]*centralRecord)
+		for _, rec := range cd.records {
+			if prev, ok := first[rec.headerPos]; ok {
+				warnings = append(warnings, fmt.Sprintf("central directory records %q and %q point to the same local header at %d", prev.name, rec.name, rec.headerPos))
+				continue
+			}
+			first[rec.headerPos] = rec
+		}
+	}
+	byEnd := make(map[int64]entryData)
+	for _, e := range entries {
+		if e.end <= e.start {
+			continue
+		}
+		prev, ok := byEnd[e.end]
+		if !ok {
+			byEnd[e.end] = e
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("entries %q and %q share the data at %d-%d", prev.name, e.name, e.start, e.end))
+	}
+	return warnings
+}
+
+// checkCentralOrder warns when the central directory lists entries in a
+// different order than their local headers appear in. Reordering can
+// influence which entry a parser processes first.
+func checkCentralOrder(cd *centralDirectory) []string {
+	for i := 1; i < len(cd.records); i++ {
+		prev, rec := cd.records[i-1], cd.records[i]
+		if rec.headerPos < prev.headerPos {
+			return []string{fmt.Sprintf("central directory lists %q (header at %d) before %q (header at %d), not in local header order",
+				prev.name, prev.headerPos, rec.name, rec.headerPos)}
+		}
+	}
+	return nil
+}
+
+// PhantomCentral is a central directory record without a local file
+// header at the offset it points to, the inverse of a hidden entry. Inside
+// names the entry whose data it points into, if any.
+type PhantomCentral struct {
+	Name         string `json:"name"`
+	HeaderOffset int64  `json:"headerOffset"`
+	Inside       string `json:"inside,omitempty"`
+}
+
+func (p PhantomCentral) String() string {
+	s := fmt.Sprintf("phantom central directory entry %q points to %d", p.Name, p.HeaderOffset)
+	if p.Inside != "" {
+		s += fmt.Sprintf(" inside the data of %q", p.Inside)
+	}
+	return s + ", not to a local header"
+}
+
+// checkCentralOffsets verifies that every central directory record points
+// to a local file header. Records that don't, in particular those pointing
+// into the data of an entry, are a sign of a manipulated directory and
+// can't be extracted.
+func checkCentralOffsets(r io.ReaderAt, cd *centralDirectory, entries []entryData) []PhantomCentral {
+	var phantoms []PhantomCentral
+	for _, rec := range cd.records {
+		var sig [4]byte
+		if _, err := r.ReadAt(sig[:], rec.headerPos); err == nil && binary.LittleEndian.Uint32(sig[:]) == fileHeaderSignature {
+			continue
+		}
+		p := PhantomCentral{Name: rec.name, HeaderOffset: rec.headerPos}
+		for _, e := range entries {
+			if rec.headerPos >= e.start && rec.headerPos < e.end {
+				p.Inside = e.name
+				break
+			}
+		}
+		phantoms = append(phantoms, p)
+	}
+	return phantoms
+}
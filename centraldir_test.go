@@ -0,0 +1,55 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// eocdRecord returns an end of central directory record.
+func eocdRecord(entries uint16, cdSize, cdOffset uint32) []byte {
+	b := make([]byte, 22)
+	copy(b, "PK\x05\x06")
+	binary.LittleEndian.PutUint16(b[8:], entries)
+	binary.LittleEndian.PutUint16(b[10:], entries)
+	binary.LittleEndian.PutUint32(b[12:], cdSize)
+	binary.LittleEndian.PutUint32(b[16:], cdOffset)
+	return b
+}
+
+func TestArchiveEndAt(t *testing.T) {
+	archive := mustBuildFixture(t, []fixtureFile{{name: "a.txt", content: []byte("a"), method: zip.Store}})
+	for _, tc := range []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"archive", archive, true},
+		{"entries without directory", append(bytes.Repeat([]byte{'x'}, 100), eocdRecord(3, 0, 0)...), false},
+		{"directory without entries", append(bytes.Repeat([]byte{'x'}, 100), eocdRecord(0, 46, 54)...), false},
+		{"directory too small for entries", append(bytes.Repeat([]byte{'x'}, 100), eocdRecord(2, 46, 54)...), false},
+		{"directory larger than the file", eocdRecord(1, 1000, 0), false},
+		{"empty archive", eocdRecord(0, 0, 0), true},
+	} {
+		eocdPos := int64(bytes.LastIndex(tc.data, []byte("PK\x05\x06")))
+		_, ok := archiveEndAt(bytes.NewReader(tc.data), int64(len(tc.data)), eocdPos)
+		if ok != tc.ok {
+			t.Errorf("%s: ok is %v, want %v", tc.name, ok, tc.ok)
+		}
+	}
+}
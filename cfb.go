@@ -0,0 +1,339 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"unicode/utf16"
+)
+
+// cfbMagic starts OLE compound files (CFB), the container of legacy Office
+// documents.
+var cfbMagic = []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}
+
+// Special sector numbers of the CFB allocation tables.
+const (
+	cfbEndOfChain = 0xfffffffe
+	cfbFreeSect   = 0xffffffff
+	cfbMaxSect    = 0xfffffffa
+)
+
+// CFB directory entry types.
+const (
+	cfbStorage = 1
+	cfbStream  = 2
+	cfbRoot    = 5
+)
+
+// isCFB reports whether r starts with the CFB magic.
+func isCFB(r io.ReaderAt) bool {
+	var magic [8]byte
+	_, err := r.ReadAt(magic[:], 0)
+	return err == nil && bytes.Equal(magic[:], cfbMagic)
+}
+
+// cfbFile reads the streams of a compound file.
+type cfbFile struct {
+	r          io.ReaderAt
+	size       int64
+	sectorSize int64
+	// fat and miniFAT map each sector to the next one of its chain.
+	fat, miniFAT []uint32
+	// Streams shorter than cutoff are stored in 64 byte sectors of the
+	// mini stream.
+	cutoff     uint64
+	miniStream []byte
+	dir        []cfbEntry
+}
+
+// cfbEntry is an entry of the CFB directory.
+type cfbEntry struct {
+	name               string
+	typ                byte
+	left, right, child uint32
+	start              uint32
+	size               uint64
+}
+
+// cfbStreamInfo is a stream with its path through the storages.
+type cfbStreamInfo struct {
+	path  string
+	entry *cfbEntry
+}
+
+func openCFB(r io.ReaderAt, size int64) (*cfbFile, error) {
+	var hdr [512]byte
+	if _, err := r.ReadAt(hdr[:], 0); err != nil {
+		return nil, fmt.Errorf("reading CFB header: %w", err)
+	}
+	le := binary.LittleEndian
+	shift := le.Uint16(hdr[0x1e:])
+	if shift != 9 && shift != 12 {
+		return nil, fmt.Errorf("invalid CFB sector shift %d", shift)
+	}
+	c := &cfbFile{r: r, size: size, sectorSize: 1 << shift, cutoff: uint64(le.Uint32(hdr[0x38:]))}
+
+	// The DIFAT lists the sectors of the FAT, the first 109 in the header.
+	var difat []uint32
+	for i := 0; i < 109; i++ {
+		difat = append(difat, le.Uint32(hdr[0x4c+4*i:]))
+	}
+	// Every FAT sector takes up a sector of the file, which bounds the
+	// DIFAT of a crafted file that loops or claims too many sectors.
+	maxFAT := int(size / c.sectorSize)
+	seen := make(map[uint32]bool)
+	next := le.Uint32(hdr[0x44:])
+	for n := le.Uint32(hdr[0x48:]); n > 0 && next <= cfbMaxSect && !seen[next] && len(difat) < maxFAT; n-- {
+		seen[next] = true
+		sec, err := c.sector(next)
+		if err != nil {
+			return nil, fmt.Errorf("reading CFB DIFAT: %w", err)
+		}
+		for i := 0; i < len(sec)/4-1; i++ {
+			difat = append(difat, le.Uint32(sec[4*i:]))
+		}
+		next = le.Uint32(sec[len(sec)-4:])
+	}
+	if len(difat) > maxFAT {
+		difat = difat[:maxFAT]
+	}
+	for _, s := range difat[:min32(le.Uint32(hdr[0x2c:]), len(difat))] {
+		if s > cfbMaxSect {
+			continue
+		}
+		sec, err := c.sector(s)
+		if err != nil {
+			return nil, fmt.Errorf("reading CFB FAT: %w", err)
+		}
+		for i := 0; i < len(sec); i += 4 {
+			c.fat = append(c.fat, le.Uint32(sec[i:]))
+		}
+	}
+
+	dir, err := c.chain(le.Uint32(hdr[0x30:]), -1)
+	if err != nil {
+		return nil, fmt.Errorf("reading CFB directory: %w", err)
+	}
+	for i := 0; i+128 <= len(dir); i += 128 {
+		d := dir[i : i+128]
+		n := int(le.Uint16(d[0x40:]))
+		if n > 64 {
+			n = 64
+		}
+		u := make([]uint16, 0, n/2)
+		for j := 0; j+1 < n; j += 2 {
+			u = append(u, le.Uint16(d[j:]))
+		}
+		if len(u) > 0 && u[len(u)-1] == 0 {
+			u = u[:len(u)-1]
+		}
+		c.dir = append(c.dir, cfbEntry{
+			name:  string(utf16.Decode(u)),
+			typ:   d[0x42],
+			left:  le.Uint32(d[0x44:]),
+			right: le.Uint32(d[0x48:]),
+			child: le.Uint32(d[0x4c:]),
+			start: le.Uint32(d[0x74:]),
+			size:  le.Uint64(d[0x78:]),
+		})
+	}
+	if len(c.dir) == 0 || c.dir[0].typ != cfbRoot {
+		return nil, errors.New("CFB directory has no root entry")
+	}
+	if c.sectorSize == 512 {
+		// Version 3 files may have garbage in the high half.
+		for i := range c.dir {
+			c.dir[i].size &= 0xffffffff
+		}
+	}
+
+	mini, err := c.chain(le.Uint32(hdr[0x3c:]), -1)
+	if err != nil {
+		return nil, fmt.Errorf("reading CFB mini FAT: %w", err)
+	}
+	for i := 0; i+4 <= len(mini); i += 4 {
+		c.miniFAT = append(c.miniFAT, le.Uint32(mini[i:]))
+	}
+	root := &c.dir[0]
+	if root.size > uint64(size) {
+		return nil, fmt.Errorf("CFB mini stream of %d bytes in a file of %d", root.size, size)
+	}
+	if c.miniStream, err = c.chain(root.start, int64(root.size)); err != nil {
+		return nil, fmt.Errorf("reading CFB mini stream: %w", err)
+	}
+	return c, nil
+}
+
+// min32 returns the smaller of n and max.
+func min32(n uint32, max int) int {
+	if int64(n) < int64(max) {
+		return int(n)
+	}
+	return max
+}
+
+// sector reads the sector with number n.
+func (c *cfbFile) sector(n uint32) ([]byte, error) {
+	off := (int64(n) + 1) * c.sectorSize
+	if off+c.sectorSize > c.size {
+		return nil, fmt.Errorf("CFB sector %d past the end of the file", n)
+	}
+	buf := make([]byte, c.sectorSize)
+	_, err := c.r.ReadAt(buf, off)
+	return buf, err
+}
+
+// chain reads the sectors of the FAT chain starting at start, up to size
+// bytes if size isn't negative.
+func (c *cfbFile) chain(start uint32, size int64) ([]byte, error) {
+	return io.ReadAll(&cfbChainReader{c: c, next: start, left: size})
+}
+
+// cfbChainReader reads the sectors of a FAT chain one at a time.
+type cfbChainReader struct {
+	c    *cfbFile
+	next uint32
+	// left is the number of bytes still to read, or negative to read up
+	// to the end of the chain.
+	left int64
+	// steps counts the sectors read. A chain can't be longer than the FAT,
+	// anything else loops.
+	steps int
+	sec   []byte
+}
+
+func (r *cfbChainReader) Read(p []byte) (int, error) {
+	if len(r.sec) == 0 {
+		if r.left == 0 || r.next > cfbMaxSect {
+			return 0, io.EOF
+		}
+		if r.steps > len(r.c.fat) || int(r.next) >= len(r.c.fat) {
+			return 0, fmt.Errorf("broken CFB sector chain at %d", r.next)
+		}
+		sec, err := r.c.sector(r.next)
+		if err != nil {
+			return 0, err
+		}
+		if r.left >= 0 && int64(len(sec)) > r.left {
+			sec = sec[:r.left]
+		}
+		if r.left >= 0 {
+			r.left -= int64(len(sec))
+		}
+		r.sec, r.next = sec, r.c.fat[r.next]
+		r.steps++
+	}
+	n := copy(p, r.sec)
+	r.sec = r.sec[n:]
+	return n, nil
+}
+
+// miniChain reads size bytes from the mini stream chain starting at start.
+func (c *cfbFile) miniChain(start uint32, size int64) ([]byte, error) {
+	var data []byte
+	for n, s := 0, start; s <= cfbMaxSect && int64(len(data)) < size; n++ {
+		off := int64(s) * 64
+		if n > len(c.miniFAT) || int(s) >= len(c.miniFAT) || off+64 > int64(len(c.miniStream)) {
+			return nil, fmt.Errorf("broken CFB mini sector chain at %d", s)
+		}
+		data = append(data, c.miniStream[off:off+64]...)
+		s = c.miniFAT[s]
+	}
+	if int64(len(data)) > size {
+		data = data[:size]
+	}
+	return data, nil
+}
+
+// streams lists the streams in directory order, with their paths.
+func (c *cfbFile) streams() []cfbStreamInfo {
+	var streams []cfbStreamInfo
+	seen := make(map[uint32]bool)
+	var walk func(id uint32, prefix string)
+	walk = func(id uint32, prefix string) {
+		if id > cfbMaxSect || int(id) >= len(c.dir) || seen[id] {
+			return
+		}
+		seen[id] = true
+		e := &c.dir[id]
+		walk(e.left, prefix)
+		switch e.typ {
+		case cfbStream:
+			streams = append(streams, cfbStreamInfo{prefix + e.name, e})
+		case cfbStorage:
+			walk(e.child, prefix+e.name+"/")
+		}
+		walk(e.right, prefix)
+	}
+	walk(c.dir[0].child, "")
+	return streams
+}
+
+// open returns a reader for the content of the stream e. Streams in the
+// mini stream are short and already in memory, others are read sector by
+// sector.
+func (c *cfbFile) open(e *cfbEntry) (io.Reader, error) {
+	if e.size < c.cutoff {
+		data, err := c.miniChain(e.start, int64(e.size))
+		return bytes.NewReader(data), err
+	}
+	if e.size > uint64(c.size) {
+		return nil, fmt.Errorf("CFB stream of %d bytes in a file of %d", e.size, c.size)
+	}
+	return &cfbChainReader{c: c, next: e.start, left: int64(e.size)}, nil
+}
+
+// scanCFBStreams searches every stream of the compound file f for headers.
+// Entries are reported as "file.doc/storage/stream!entry".
+func scanCFBStreams(f readSeekerAt, filename string, cfg *config, rep reporter, s *Summary) error {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	c, err := openCFB(f, size)
+	if err != nil {
+		return err
+	}
+	// Offsets within streams don't relate to the compound file.
+	scfg := *cfg
+	scfg.start, scfg.checkpoint, scfg.skip = 0, nil, 0
+	for _, st := range c.streams() {
+		// Streams can't seek, so they are buffered like stdin.
+		r, err := c.open(st.entry)
+		var stream readSeekerAt
+		cleanup := func() {}
+		if err == nil {
+			stream, cleanup, err = bufferInput(r, cfg.spill)
+		}
+		if err != nil {
+			s.Warnings = append(s.Warnings, fmt.Sprintf("stream %s: %v", st.path, err))
+			continue
+		}
+		var ss Summary
+		container := path.Base(filename) + "/" + st.path
+		err = scanFileHeaders(stream, &scfg, &prefixReporter{rep, container}, &ss)
+		cleanup()
+		s.merge(&ss, container+"!")
+		if err != nil {
+			return fmt.Errorf("stream %s: %w", st.path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// checkpointInterval limits how often the checkpoint file is rewritten.
+const checkpointInterval = time.Second
+
+// checkpoint records in a file the offset a scan can resume from. As it is
+// only written now and then, a resumed scan may repeat a few entries.
+type checkpoint struct {
+	filename string
+	written  time.Time
+}
+
+// record writes pos to the checkpoint file if the last write is long
+// enough ago or force is set.
+func (c *checkpoint) record(pos int64, force bool) error {
+	if !force && time.Since(c.written) < checkpointInterval {
+		return nil
+	}
+	c.written = time.Now()
+	// Replace the file atomically so an interrupted write doesn't lose the
+	// previous checkpoint.
+	tmp := c.filename + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(pos, 10)+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.filename)
+}
+
+// readCheckpoint returns the offset recorded in filename. A missing file
+// means there is nothing to resume.
+func readCheckpoint(filename string) (int64, bool, error) {
+	b, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	pos, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil || pos < 0 {
+		return 0, false, fmt.Errorf("%s: invalid checkpoint %q", filename, strings.TrimSpace(string(b)))
+	}
+	return pos, true, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// stopReporter fails on the first entry, like an interrupted scan.
+type stopReporter struct{}
+
+var errStop = errors.New("stop")
+
+func (stopReporter) entry(h *FileHeader) error { return errStop }
+func (stopReporter) summary(s *Summary) error  { return nil }
+
+// TestCheckpointSuppressed checks that entries suppressed by
+// -ignore-hashes count as progress, so a resumed scan doesn't hash them
+// again.
+func TestCheckpointSuppressed(t *testing.T) {
+	ignored := []byte("known file")
+	archive := mustBuildFixture(t, []fixtureFile{
+		{name: "known.txt", content: ignored, method: zip.Store},
+		{name: "b.txt", content: []byte("b"), method: zip.Store},
+	})
+	sum := sha256.Sum256(ignored)
+	cfg := newConfig(nil)
+	cfg.ignoreHashes = map[string]bool{hex.EncodeToString(sum[:]): true}
+	cfg.checkpoint = &checkpoint{filename: filepath.Join(t.TempDir(), "checkpoint")}
+	var s Summary
+	if err := scanFileHeaders(bytes.NewReader(archive), cfg, stopReporter{}, &s); err != errStop {
+		t.Fatalf("got %v, want the reporter's error", err)
+	}
+	if s.Suppressed != 1 {
+		t.Fatalf("suppressed %d entries, want 1", s.Suppressed)
+	}
+	pos, ok, err := readCheckpoint(cfg.checkpoint.filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// known.txt starts at 0, its data follows the 30 byte header.
+	if !ok || pos < 30+int64(len("known.txt")) {
+		t.Errorf("checkpoint at %d (%v), want past the header of known.txt", pos, ok)
+	}
+}
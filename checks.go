@@ -0,0 +1,293 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"unicode"
+	"unicode/utf8"
+)
+
+// methodMagic lists the bytes the compressed data of a method starts with.
+var methodMagic = map[uint16][]byte{
+	12: []byte("BZh"),                    // bzip2
+	93: {0x28, 0xb5, 0x2f, 0xfd},         // zstd
+	95: {0xfd, '7', 'z', 'X', 'Z', 0x00}, // xz
+}
+
+// checkMagic warns if the start of the compressed data of h doesn't fit its
+// declared compression method.
+func checkMagic(r io.ReaderAt, h *FileHeader) {
+	n := 6
+	if h.csize != 0 && h.csize < uint32(n) {
+		n = int(h.csize)
+	}
+	buf := make([]byte, n)
+	n, _ = r.ReadAt(buf, h.pos)
+	buf = buf[:n]
+
+	if magic, ok := methodMagic[h.compression]; ok {
+		if !bytes.HasPrefix(buf, magic) {
+			h.warnings = append(h.warnings, fmt.Sprintf("method %d but data doesn't start with %q", h.compression, magic))
+		}
+		return
+	}
+	switch h.compression {
+	case 14:
+		// LZMA: version (2 bytes), properties size (2 bytes, always 5),
+		// then the lc/lp/pb properties byte.
+		if len(buf) < 5 || buf[2] != 5 || buf[3] != 0 || buf[4] >= 9*5*5 {
+			h.warnings = append(h.warnings, "method 14 but data has no valid LZMA properties header")
+		}
+	case 98:
+		// PPMd: order-1 (4 bits), memory size in MB-1 (8 bits) and the
+		// restoration method (4 bits, 0 to 2).
+		if len(buf) < 2 || buf[0]&0xf == 0 || buf[1]>>4 > 2 {
+			h.warnings = append(h.warnings, "method 98 but data has no valid PPMd parameters")
+		}
+	}
+}
+
+// rareMethods are the compression methods that everyday zip tools don't
+// write, which makes finding them a mild anomaly.
+var rareMethods = map[uint16]bool{98: true}
+
+// checkMethod warns about entries using a rare compression method.
+func checkMethod(h *FileHeader) {
+	if rareMethods[h.compression] {
+		h.warnings = append(h.warnings, fmt.Sprintf("compressed with %s, which everyday zip tools rarely write", methodName(h.compression)))
+	}
+}
+
+// Integrity verdicts of -validate.
+const (
+	integrityOK         = "ok"
+	integrityCRC        = "crc-fail"
+	integritySize       = "size-fail"
+	integrityDecompress = "decompress-error"
+)
+
+// checkContent decompresses h and compares the result with the declared
+// size and CRC-32, setting h.integrity. Entries that can't be decompressed
+// at all, e.g. encrypted ones or those without a registered decompressor,
+// are left unchecked.
+//
+// Deflate streams are read to their natural end, which may lie past csize
+// if the size is lying. A stream that doesn't take up exactly csize bytes
+// means bytes smuggled in after the stream or a wrong size.
+func checkContent(r io.ReaderAt, h *FileHeader, size int64) {
+	if h.pos > size {
+		return
+	}
+	var content io.Reader
+	var cr *countingReader
+	switch {
+	case h.flags&0x1 != 0:
+		// Encrypted data can only be checked with the password, and only
+		// within csize.
+		if h.password == "" || h.decryption != decryptionOK {
+			return
+		}
+		rc, err := openEntry(r, h)
+		if err != nil {
+			return
+		}
+		defer rc.Close()
+		content = rc
+	default:
+		var data io.Reader = io.NewSectionReader(r, h.pos, int64(h.csize))
+		if h.compression == 8 {
+			cr = &countingReader{r: bufio.NewReader(io.NewSectionReader(r, h.pos, size-h.pos))}
+			data = cr
+		}
+		// Registered decompressors other than deflate are held to csize.
+		dcomp := decompressor(h.compression)
+		if dcomp == nil {
+			return
+		}
+		rc := budgeted(h, dcomp(data))
+		defer rc.Close()
+		content = rc
+	}
+	sum := crc32.NewIEEE()
+	n, err := io.Copy(sum, content)
+	if err != nil {
+		h.integrity = integrityDecompress
+		h.warnings = append(h.warnings, fmt.Sprintf("decompression failed: %v", err))
+		return
+	}
+	if cr != nil {
+		if delta := int64(h.csize) - cr.n; delta != 0 {
+			h.warnings = append(h.warnings, fmt.Sprintf("deflate stream is %d bytes, csize %d (%+d)", cr.n, h.csize, delta))
+		}
+	}
+	h.integrity = integrityOK
+	if n != int64(h.size) {
+		h.integrity = integritySize
+		h.warnings = append(h.warnings, fmt.Sprintf("size mismatch: declared %d, actual %d", h.size, n))
+	}
+	// Version 2 of WinZip AES leaves out the CRC-32.
+	if ae, err := parseWinZipAES(h.extra); err == nil && h.compression == 99 && ae.version == 2 {
+		return
+	}
+	if got := sum.Sum32(); got != h.crc32 {
+		if h.integrity == integrityOK {
+			h.integrity = integrityCRC
+		}
+		h.warnings = append(h.warnings, fmt.Sprintf("crc mismatch: declared %08x, actual %08x", h.crc32, got))
+	}
+}
+
+// countingReader counts the bytes read from r. As it is an io.ByteReader,
+// flate reads no more than the stream needs.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// checkCentral warns about noteworthy attributes in the central directory
+// record of h.
+func checkCentral(h *FileHeader) {
+	if h.central == nil {
+		return
+	}
+	if mode, ok := h.central.unixMode(); ok {
+		if mode&04000 != 0 {
+			h.warnings = append(h.warnings, "setuid")
+		}
+		if mode&02000 != 0 {
+			h.warnings = append(h.warnings, "setgid")
+		}
+	}
+}
+
+// checkOwner warns about hidden entries owned by root, which are unusual
+// in archives created by regular users.
+func checkOwner(h *FileHeader) {
+	if h.hidden && h.owner != nil && (h.owner.uid == 0 || h.owner.gid == 0) {
+		h.warnings = append(h.warnings, fmt.Sprintf("hidden entry owned by %d:%d", h.owner.uid, h.owner.gid))
+	}
+}
+
+// checkName warns about names with control or zero-width characters,
+// which can disguise extensions or inject terminal escape sequences.
+func checkName(h *FileHeader) {
+	if hasHiddenRunes(h.name) {
+		h.warnings = append(h.warnings, fmt.Sprintf("name contains control or zero-width characters: %q", h.name))
+	}
+}
+
+// hasHiddenRunes reports whether s contains control characters, zero-width
+// or bidirectional formatting characters.
+func hasHiddenRunes(s string) bool {
+	for _, r := range s {
+		switch {
+		case unicode.IsControl(r),
+			r >= 0x200b && r <= 0x200f, // zero-width space, joiners and marks
+			r >= 0x202a && r <= 0x202e, // bidirectional embeddings and overrides
+			r >= 0x2060 && r <= 0x2069, // word joiner, invisible operators, isolates
+			r == 0xfeff:                // zero-width no-break space
+			return true
+		}
+	}
+	return false
+}
+
+// checkModTime warns about timestamps in the future or before the
+// configured minimum year.
+func checkModTime(h *FileHeader, cfg *config) {
+	if isZeroedTime(h) {
+		return
+	}
+	t := h.modTime
+	if t.After(cfg.now.Add(cfg.maxFuture)) {
+		h.warnings = append(h.warnings, "modified in the future: "+t.Format("2006-01-02"))
+	}
+	if t.Year() < cfg.minYear {
+		h.warnings = append(h.warnings, fmt.Sprintf("modified before %d: %s", cfg.minYear, t.Format("2006-01-02")))
+	}
+}
+
+// isZeroedTime reports whether the timestamp of h is zero or exactly the
+// MS-DOS epoch, as written by tools that strip timestamps.
+func isZeroedTime(h *FileHeader) bool {
+	return h.mtime == 0 && (h.mdate == 0 || h.mdate == 1<<5|1)
+}
+
+// maxCommentLength is the archive comment length above which the comment
+// is flagged. Regular archives rarely have comments at all.
+const maxCommentLength = 1024
+
+// checkComment returns warnings about an archive comment that might hide
+// data.
+func checkComment(comment []byte) []string {
+	var warnings []string
+	if len(comment) > maxCommentLength {
+		warnings = append(warnings, fmt.Sprintf("archive comment is %d bytes long", len(comment)))
+	}
+	if !isPrintable(comment) {
+		warnings = append(warnings, "archive comment contains non-printable characters")
+	} else if isBase64Like(comment) {
+		warnings = append(warnings, "archive comment looks like base64")
+	}
+	return warnings
+}
+
+// isPrintable reports whether b is UTF-8 text without control characters
+// other than whitespace.
+func isPrintable(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, c := range b {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// isBase64Like reports whether b is a longer run of base64 characters.
+func isBase64Like(b []byte) bool {
+	n := 0
+	for _, c := range b {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '+', c == '/', c == '=':
+			n++
+		case c == '\n' || c == '\r':
+		default:
+			return false
+		}
+	}
+	return n >= 64
+}
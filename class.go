@@ -0,0 +1,154 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// Entry classes: normal entries are valid and listed by the central
+// directory, hidden ones are valid but unlisted, phantom ones are signature
+// matches that fail the validity checks. Valid entries are unknown if
+// archive/zip can't open the archive to tell which ones it lists.
+const (
+	classNormal  = "normal"
+	classHidden  = "hidden"
+	classPhantom = "phantom"
+	classUnknown = "unknown"
+)
+
+// knownMethods are the compression methods defined by APPNOTE.
+var knownMethods = map[uint16]bool{
+	0: true, 1: true, 2: true, 3: true, 4: true, 5: true, 6: true, 8: true, 9: true, 10: true,
+	12: true, 14: true, 16: true, 18: true, 19: true, 93: true, 94: true, 95: true, 96: true, 97: true, 98: true, 99: true,
+}
+
+// methodNames are the names of the common compression methods.
+var methodNames = map[uint16]string{
+	0: "stored", 1: "shrunk", 6: "imploded", 8: "deflate", 9: "deflate64", 12: "bzip2",
+	14: "lzma", 93: "zstd", 95: "xz", 96: "jpeg", 97: "wavpack", 98: "PPMd", 99: "aes",
+}
+
+// methodName names a compression method for messages, e.g. "lzma (14)".
+func methodName(method uint16) string {
+	if name, ok := methodNames[method]; ok {
+		return fmt.Sprintf("%s (%d)", name, method)
+	}
+	return fmt.Sprintf("%d", method)
+}
+
+// maxDeflateRatio is the highest ratio of size to csize deflate can reach.
+const maxDeflateRatio = 1032
+
+// sizeBounds are the plausible declared sizes of an entry, set with
+// -min-entry-size and -max-entry-size. A zero max means no upper bound.
+type sizeBounds struct {
+	min, max int64
+}
+
+// sizeReasons returns why the declared sizes of h are implausible in a file
+// of the given size, which needs no content to be read.
+func sizeReasons(h *FileHeader, size int64, b sizeBounds) []string {
+	var reasons []string
+	if left := size - h.pos; int64(h.csize) > left {
+		reasons = append(reasons, fmt.Sprintf("csize=%d exceeds the %d bytes left in the file", h.csize, left))
+	}
+	if h.sizeSource != sizeInferred {
+		switch {
+		case h.compression == 0 && h.flags&0x1 == 0 && h.size != h.csize:
+			reasons = append(reasons, fmt.Sprintf("stored entry with size=%d but csize=%d", h.size, h.csize))
+		case h.compression == 8 && h.csize > 0 && uint64(h.size) > maxDeflateRatio*uint64(h.csize):
+			reasons = append(reasons, fmt.Sprintf("size=%d beyond what csize=%d of deflate can hold", h.size, h.csize))
+		}
+	}
+	if int64(h.size) < b.min {
+		reasons = append(reasons, fmt.Sprintf("size=%d below the minimum of %d", h.size, b.min))
+	}
+	if b.max > 0 && int64(h.size) > b.max {
+		reasons = append(reasons, fmt.Sprintf("size=%d above the maximum of %d", h.size, b.max))
+	}
+	return reasons
+}
+
+// phantomReasons returns why the header h is unlikely to be a real entry
+// in a file of the given size.
+func phantomReasons(h *FileHeader, size int64, b sizeBounds) []string {
+	var reasons []string
+	if !knownMethods[h.compression] {
+		reasons = append(reasons, fmt.Sprintf("compression=%d not a known method", h.compression))
+	}
+	if v := h.version & 0xff; v > 63 {
+		reasons = append(reasons, fmt.Sprintf("version=%d beyond the specification", v))
+	}
+	if h.namelen == 0 {
+		reasons = append(reasons, "empty name")
+	} else if !utf8.ValidString(h.name) && h.flags&0x800 != 0 {
+		reasons = append(reasons, "name flagged UTF-8 but invalid")
+	}
+	reasons = append(reasons, sizeReasons(h, size, b)...)
+	if h.integrity == integrityDecompress {
+		reasons = append(reasons, "content doesn't decompress")
+	}
+	return reasons
+}
+
+// classify sets the class of h.
+func classify(h *FileHeader, size int64, b sizeBounds, visibilityKnown bool) {
+	h.phantomReasons = phantomReasons(h, size, b)
+	switch {
+	case h.phantomReasons != nil:
+		h.class = classPhantom
+	case !visibilityKnown:
+		h.class = classUnknown
+	case h.hidden:
+		h.class = classHidden
+	default:
+		h.class = classNormal
+	}
+}
+
+// onlyFilters select the entries printed by -only. Suspicious entries are
+// hidden or phantom ones and those with warnings.
+var onlyFilters = map[string]func(*FileHeader) bool{
+	"normal":  func(h *FileHeader) bool { return h.class == classNormal },
+	"hidden":  func(h *FileHeader) bool { return h.class == classHidden },
+	"phantom": func(h *FileHeader) bool { return h.class == classPhantom },
+	"unknown": func(h *FileHeader) bool { return h.class == classUnknown },
+	"suspicious": func(h *FileHeader) bool {
+		return h.class == classHidden || h.class == classPhantom || len(h.warnings) > 0
+	},
+}
+
+// isChained reports whether h is part of a coherent archive: it is listed in
+// the central directory or its data is followed by another zip structure.
+func isChained(r io.ReaderAt, h *FileHeader, size int64) bool {
+	if h.central != nil {
+		return true
+	}
+	end := h.pos + int64(h.csize) + descriptorLen(r, h)
+	return end <= size-4 && zipStructureAt(r, end)
+}
+
+// incoherentError is returned for inputs with fewer chained entries than
+// -min-entries-for-valid asks for.
+type incoherentError struct {
+	matches int
+}
+
+func (e *incoherentError) Error() string {
+	return fmt.Sprintf("no coherent zip structure found (%d isolated matches)", e.matches)
+}
@@ -0,0 +1,460 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build !(js && wasm)
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	hash := flag.Bool("hash", false, "print the SHA-256 of each entry's decompressed content")
+	sqliteFile := flag.String("sqlite", "", "write the entries and archive summaries of all inputs to the SQLite database `file`")
+	carvePlanFile := flag.String("carve-plan", "", "write \"offset length name\" carving instructions for all entries but those of nested scans to `file`")
+	catName := flag.String("cat", "", "write the decompressed content of the entry called `name` to stdout")
+	yaraName := flag.String("yara", "", "print a YARA rule matching the local header and first content bytes of the entry called `name`")
+	yaraBytes := flag.Int("yara-bytes", 32, "match the first `n` content bytes with -yara")
+	rawScanFlag := flag.Bool("raw-scan", false, "print the offset of every local file header signature, without parsing headers")
+	summaryOnly := flag.Bool("summary-only", false, "print only one line per input: path, entries, hidden entries, suspicious entries and a verdict of clean, suspicious or hidden-found")
+	byteMap := flag.Bool("map", false, "draw a map of the headers, entry data, central directory and unaccounted gaps in the file")
+	compare := flag.Bool("compare-stdlib", false, "list which entries the scanner and archive/zip each see")
+	diff := flag.String("diff", "", "compare the entries against those of `other.zip`")
+	extractSigning := flag.String("extract-signing-block", "", "write the values of the APK signing block to files in `dir`")
+	verify := flag.String("verify", "", "check the entries against a `manifest` written by -json -hash")
+	ignoreHashes := flag.String("ignore-hashes", "", "suppress entries whose SHA-256 is listed in `file`")
+	scanEntry := flag.String("scan-entry", "", "search the content of entry `name` for nested headers")
+	scanStored := flag.Bool("scan-stored", false, "search the content of stored entries for headers as well")
+	var readAheadSize byteSize
+	flag.Var(&readAheadSize, "readahead", "read the input in chunks of `size` (e.g. 4m)")
+	tarMembers := flag.Bool("tar-members", false, "scan the zip members of a tar input one by one")
+	oleStreams := flag.Bool("ole-streams", false, "scan the streams of an OLE compound file (legacy Office documents) one by one")
+	maxFuture := flag.Duration("max-future", defaultMaxFuture, "flag entries modified more than `duration` in the future")
+	minYear := flag.Int("min-year", defaultMinYear, "flag entries modified before `year`")
+	showComment := flag.Bool("show-comment", false, "print the archive comment")
+	only := flag.String("only", "", "print only `class` entries: suspicious, hidden, phantom, normal or unknown; exit with status 4 if there are any")
+	hiddenOnly := flag.Bool("hidden-only", false, "print only entries that archive/zip doesn't list")
+	explainFlag := flag.Bool("explain", false, "list the signals behind the class and confidence of every entry")
+	noDirs := flag.Bool("no-dirs", false, "leave out directory entries")
+	stopAtEOCD := flag.Bool("stop-at-eocd", false, "stop at the end of the first archive instead of scanning the whole file")
+	utc := flag.Bool("utc", false, "show times in UTC; MS-DOS times are taken to be UTC instead of local time")
+	inflateFirst := flag.Bool("inflate-first", false, "decompress zlib or raw deflate input before scanning, falling back to the raw bytes")
+	var maxMemory byteSize
+	flag.Var(&maxMemory, "max-memory", "keep up to `n` bytes of input that can't seek in memory before spilling to a temporary file (default 64m)")
+	tmpDir := flag.String("tmp-dir", "", "create spill files in `dir` instead of the default temporary directory")
+	password := flag.String("password", "", "decrypt ZipCrypto and WinZip AES entries with `password` for extraction and validation")
+	minConfidence := flag.Int("min-confidence", 0, "print only entries with a confidence of at least `n` (0-100)")
+	minEntries := flag.Int("min-entries-for-valid", 0, "exit with status 1 unless the input has at least `n` chained entries (listed in the central directory or followed by another zip structure)")
+	follow := flag.Bool("follow", false, "keep scanning data appended to a growing file until it is idle")
+	followIdle := flag.Duration("follow-idle", 10*time.Second, "how long a file must not grow for -follow to stop")
+	showRejects := flag.Bool("show-rejects", false, "explain signature matches that aren't taken as headers, with their raw bytes")
+	strict := flag.Bool("strict", false, "reject headers whose extra field runs past the end of the file or whose sizes are implausible")
+	var minEntrySize, maxEntrySize byteSize
+	flag.Var(&minEntrySize, "min-entry-size", "treat entries declaring fewer than `n` bytes as phantom, or reject them with -strict")
+	flag.Var(&maxEntrySize, "max-entry-size", "treat entries declaring more than `n` bytes as phantom, or reject them with -strict")
+	centralOnly := flag.Bool("no-content-scan", false, "list the entries of the central directory, only confirming their local headers")
+	entropy := flag.Bool("entropy", false, "compute the entropy of each entry's decompressed content in bits per byte")
+	entropyThreshold := flag.Float64("entropy-threshold", defaultEntropyThreshold, "flag entries with an entropy above `bits` per byte with -entropy")
+	validate := flag.Bool("validate", false, "decompress entries to check that their content matches the header")
+	var maxDecompressed byteSize
+	flag.Var(&maxDecompressed, "max-decompressed", "stop decompressing an entry once it, or all entries of the input together, exceed `n` bytes, guarding against zip bombs")
+	var skip byteSize
+	flag.Var(&skip, "skip", "don't search the first `n` bytes, e.g. a known SFX stub; reported offsets stay absolute")
+	resumeFrom := flag.Int64("resume-from", 0, "start searching for headers at `offset`; reported offsets stay absolute")
+	checkpointFile := flag.String("checkpoint", "", "record the offset reached in `file` and resume from it if it exists")
+	fieldList := flag.String("fields", "", "print the comma-separated `fields` of each entry, e.g. name,offset,size,crc32,method")
+	buckets := flag.Bool("buckets", false, "group the entries into normal, hidden and phantom ones, same as -group-by status")
+	groupBy := flag.String("group-by", "", "group the entries by `key`: method (compression method), dir (top-level directory) or status (class)")
+	tree := flag.Bool("tree", false, "show the entries of nested scans as a tree with per-level statistics")
+	sortKey := flag.String("sort", "offset", "sort entries by `key`: offset, name, size, ratio (size/csize), confidence or central (central directory order)")
+	reverse := flag.Bool("reverse", false, "reverse the sort order")
+	colorMode := flag.String("color", "auto", "highlight suspicious and hidden entries: `auto`, always or never")
+	verbose := flag.Bool("v", false, "print all header fields and decoded flags")
+	namesOnly := flag.Bool("names-only", false, "print only the name of each entry, one per line")
+	canonical := flag.Bool("canonical", false, "print a deterministic text form for diffing: sorted by offset, fixed fields, UTC times")
+	tskOutput := flag.Bool("tsk", false, "print tab-separated carved-file records for forensic suites")
+	tarOutput := flag.String("tar", "", "write the decompressed entries to the tar archive `out.tar`")
+	extractDir := flag.String("extract", "", "extract the decompressed entries to `dir`")
+	extractHidden := flag.String("extract-hidden", "", "extract only the hidden entries, those archive/zip doesn't list, to `dir`")
+	sanitize := flag.Bool("sanitize", false, "rewrite unsafe entry names when extracting instead of skipping them")
+	jsonOutput := flag.Bool("json", false, "print entries as newline-delimited JSON, followed by a summary record")
+	protoOutput := flag.Bool("proto", false, "print entries and the summary as length-delimited protobuf records, see hidden_zip.proto")
+	jsonPretty := flag.Bool("json-pretty", false, "print a single indented JSON document instead of one line per entry, or an array of them for several inputs")
+	inputList := flag.String("input-list", "", "also scan the paths listed in `file`, one per line (- for stdin)")
+	showMetrics := flag.Bool("metrics", false, "print bytes scanned, entries, phantom matches, time elapsed and throughput to stderr at the end")
+	metricsFormat := flag.String("metrics-format", "text", "print -metrics as `text` or prometheus")
+	selftestFlag := flag.Bool("selftest", false, "build an archive with a hidden entry using archive/zip, scan it and check the results")
+	recursive := flag.Bool("r", false, "scan the files below directory arguments that look like zip archives")
+	jobs := flag.Int("j", 1, "scan up to `n` files at the same time, or hash up to n entries at the same time when scanning a single file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <file.zip|->...\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Find hidden files in a Zip archive by looking for local file headers.")
+		flag.PrintDefaults()
+		fmt.Fprintln(flag.CommandLine.Output(), "Exit status is 1 for an incoherent archive with -min-entries-for-valid, 2 for usage errors,")
+		fmt.Fprintln(flag.CommandLine.Output(), "3 if an input has no zip structure at all, 4 if -only printed any entries or -summary-only")
+		fmt.Fprintln(flag.CommandLine.Output(), "found a suspicious input, 5 if the archive drifted from its -verify manifest and 6 if an")
+		fmt.Fprintln(flag.CommandLine.Output(), "input couldn't be opened or read.")
+	}
+	flag.Parse()
+	// Don't leave spill files or unterminated JSON behind when interrupted.
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		closeDocuments()
+		removeTempFiles()
+		os.Exit(130)
+	}()
+	if *selftestFlag {
+		if !selftest(os.Stdout) {
+			fmt.Println("FAIL")
+			os.Exit(1)
+		}
+		fmt.Println("PASS")
+		return
+	}
+	files := flag.Args()
+	if *inputList != "" {
+		paths, err := readInputList(*inputList)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		files = append(files, paths...)
+	}
+	if *recursive {
+		files = expandDirs(files)
+	}
+	single := *diff != "" || *catName != "" || *yaraName != "" || *resumeFrom != 0 || *checkpointFile != ""
+	if len(files) == 0 || single && len(files) != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	color, err := useColor(*colorMode, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	var fields []field
+	if *fieldList != "" {
+		if fields, err = parseFields(*fieldList); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	var m *metrics
+	if *showMetrics {
+		if *metricsFormat != "text" && *metricsFormat != "prometheus" {
+			fmt.Fprintf(os.Stderr, "invalid -metrics-format %q, want text or prometheus\n", *metricsFormat)
+			os.Exit(2)
+		}
+		m = newMetrics()
+	}
+
+	if _, ok := entryLess[*sortKey]; !ok {
+		fmt.Fprintf(os.Stderr, "invalid -sort %q, want offset, name, size, ratio, confidence or central\n", *sortKey)
+		os.Exit(2)
+	}
+
+	if *buckets && *groupBy == "" {
+		*groupBy = "status"
+	}
+	if _, ok := groupKeys[*groupBy]; *groupBy != "" && !ok {
+		fmt.Fprintf(os.Stderr, "invalid -group-by %q, want method, dir or status\n", *groupBy)
+		os.Exit(2)
+	}
+
+	cfg := config{hash: *hash, scanEntry: *scanEntry, scanStored: *scanStored, readAhead: int(readAheadSize), tarMembers: *tarMembers, oleStreams: *oleStreams, showComment: *showComment, hiddenOnly: *hiddenOnly, noDirs: *noDirs, explain: *explainFlag, stopAtEOCD: *stopAtEOCD, validate: *validate, centralOnly: *centralOnly, strict: *strict, password: *password, showRejects: *showRejects, inflateFirst: *inflateFirst,
+		maxFuture: *maxFuture, minYear: *minYear, now: time.Now(), loc: time.Local}
+	if *utc || *canonical {
+		cfg.loc = time.UTC
+	}
+	cfg.start, cfg.skip = *resumeFrom, int64(skip)
+	cfg.minEntries, cfg.minConfidence = *minEntries, *minConfidence
+	cfg.entropy, cfg.entropyThreshold = *entropy, *entropyThreshold
+	cfg.bounds = sizeBounds{min: int64(minEntrySize), max: int64(maxEntrySize)}
+	cfg.maxDecompressed = int64(maxDecompressed)
+	if *only != "" {
+		if cfg.only = onlyFilters[*only]; cfg.only == nil {
+			fmt.Fprintf(os.Stderr, "invalid -only %q, want suspicious, hidden, phantom or normal\n", *only)
+			os.Exit(2)
+		}
+	}
+	if *follow {
+		cfg.follow = *followIdle
+	}
+	cfg.spill = spill{maxMemory: int64(maxMemory), dir: *tmpDir}
+	if *checkpointFile != "" {
+		if pos, ok, err := readCheckpoint(*checkpointFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		} else if ok && *resumeFrom == 0 {
+			cfg.start = pos
+		}
+		cfg.checkpoint = &checkpoint{filename: *checkpointFile}
+	}
+	if *ignoreHashes != "" {
+		hashes, err := readHashList(*ignoreHashes)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		cfg.ignoreHashes = hashes
+	}
+	if *catName != "" {
+		out := bufio.NewWriter(os.Stdout)
+		err := catEntry(files[0], *catName, &cfg, out)
+		if ferr := out.Flush(); err == nil {
+			err = ferr
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *yaraName != "" {
+		if err := yaraRule(files[0], *yaraName, *yaraBytes, &cfg, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *extractSigning != "" {
+		if err := extractSigningBlock(files[0], *extractSigning, &cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *verify != "" {
+		manifest, err := readManifest(*verify)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		cfg.hash = true
+		drifted, err := verifyManifest(manifest, files[0], &cfg, os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if drifted {
+			os.Exit(5)
+		}
+		return
+	}
+	if *diff != "" {
+		cfg.hash = true
+		if err := diffArchives(*diff, files[0], &cfg, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var tw *tarWriter
+	if *tarOutput != "" {
+		out, err := os.Create(*tarOutput)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer out.Close()
+		tw = newTarWriter(out, cfg.spill)
+	}
+	var ex *extractor
+	switch {
+	case *extractDir != "" && *extractHidden != "":
+		fmt.Fprintln(os.Stderr, "-extract and -extract-hidden can't be combined")
+		os.Exit(2)
+	case *extractDir != "":
+		ex = newExtractor(*extractDir, *sanitize)
+	case *extractHidden != "":
+		ex = newExtractor(*extractHidden, *sanitize)
+		ex.hiddenOnly = true
+	}
+	multi := len(files) > 1
+	if !multi {
+		// With one file, the entries are the unit of work.
+		cfg.hashJobs = *jobs
+	}
+	var st runStatus
+	var plan *carvePlan
+	if *carvePlanFile != "" {
+		out, err := os.Create(*carvePlanFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer out.Close()
+		plan = &carvePlan{w: out, multi: multi}
+	}
+	var db *sqliteDB
+	if *sqliteFile != "" {
+		out, err := os.Create(*sqliteFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer out.Close()
+		db = &sqliteDB{w: out}
+	}
+	// The documents of -json-pretty for several inputs go into one array,
+	// keeping the output a single JSON value.
+	jsonArray := multi && *jsonPretty
+	scan := func(i int, filename string, w io.Writer) error {
+		if *rawScanFlag {
+			if multi {
+				fmt.Fprintf(w, "==> %s <==\n", filename)
+			}
+			return rawScan(filename, w)
+		}
+		if *compare {
+			if multi {
+				fmt.Fprintf(w, "==> %s <==\n", filename)
+			}
+			return compareStdlib(filename, &cfg, w)
+		}
+		// prefix separates the JSON documents in the array.
+		prefix := ""
+		if jsonArray && i > 0 {
+			prefix = ","
+		}
+		var rep reporter = &textReporter{w: w, cfg: &cfg, verbose: *verbose, color: color, fields: fields}
+		switch {
+		case *canonical:
+			rep = &canonicalReporter{w: w}
+		case *namesOnly:
+			rep = &namesReporter{w: w}
+		case *tskOutput:
+			rep = &tskReporter{w: w, fields: fields}
+		case *protoOutput:
+			file := ""
+			if multi {
+				file = filename
+			}
+			rep = &protoReporter{w: w, file: file}
+		case *jsonOutput || *jsonPretty:
+			file := ""
+			if multi {
+				file = filename
+			}
+			rep = newJSONReporter(w, *jsonPretty, file, prefix)
+		}
+		if *byteMap {
+			rep = &mapReporter{w: w, width: mapWidth(os.Stdout)}
+		}
+		if *summaryOnly {
+			rep = &verdictReporter{w: w, file: filename, st: &st}
+		}
+		if *tree {
+			text := &textReporter{w: w, cfg: &cfg, verbose: *verbose, color: color, fields: fields}
+			file := ""
+			if multi {
+				file = filename
+			}
+			rep = &treeReporter{w: w, text: text, json: *jsonOutput || *jsonPretty, pretty: *jsonPretty, file: file, prefix: prefix}
+		}
+		if *groupBy != "" && !*jsonOutput && !*jsonPretty && !*protoOutput {
+			grouped, err := newGroupReporter(w, &textReporter{w: w, cfg: &cfg, verbose: *verbose, color: color, fields: fields}, *groupBy)
+			if err != nil {
+				return err
+			}
+			rep = grouped
+		}
+		if multi && !*jsonOutput && !*jsonPretty && !*protoOutput && !*summaryOnly {
+			fmt.Fprintf(w, "==> %s <==\n", filename)
+		}
+		if *sortKey != "offset" || *reverse {
+			// Scan order is offset order, so only other orders need
+			// buffering.
+			sorted, err := newSortingReporter(rep, *sortKey, *reverse)
+			if err != nil {
+				return err
+			}
+			rep = sorted
+		}
+		if plan != nil {
+			rep = plan.reporter(rep, filename)
+		}
+		if db != nil {
+			rep = db.reporter(rep, filename)
+		}
+		if tw != nil {
+			rep = &teeReporter{rep, tw, "tar output"}
+		}
+		if ex != nil {
+			rep = &teeReporter{rep, ex, "extraction"}
+		}
+		rep = &statusReporter{rep, &st}
+		if m != nil {
+			rep = m.reporter(rep)
+		}
+		return searchFileHeaders(filename, &cfg, rep)
+	}
+	if jsonArray {
+		beginJSONArray(os.Stdout)
+	}
+	errs := scanFiles(files, *jobs, os.Stdout, scan)
+	endJSONArray()
+	if multi {
+		summarizeOpenErrors(errs, os.Stderr)
+	}
+	if tw != nil {
+		if err := tw.close(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	if db != nil {
+		if err := db.close(); err != nil {
+			fmt.Fprintln(os.Stderr, "sqlite:", err)
+		}
+	}
+	if m != nil {
+		m.write(os.Stderr, *metricsFormat == "prometheus")
+	}
+	failed := false
+	for _, err := range errs {
+		var ie *incoherentError
+		if errors.As(err, &ie) {
+			os.Exit(1)
+		}
+		failed = true
+	}
+	// Inputs that couldn't be scanned mustn't look clean.
+	if failed {
+		os.Exit(6)
+	}
+	// Inputs without any zip structure exit with 3, telling them apart from
+	// zips without findings.
+	if st.notZip != 0 {
+		os.Exit(3)
+	}
+	if cfg.only != nil && st.matched != 0 || st.flagged != 0 {
+		os.Exit(4)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build !(js && wasm)
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runMainEnv makes the test binary run main instead of the tests, so that
+// the exit status of the command can be checked.
+const runMainEnv = "HIDDEN_ZIP_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runCommand runs the command with args and returns its output and exit
+// status.
+func runCommand(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	out, err := cmd.CombinedOutput()
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		return string(out), ee.ExitCode()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out), 0
+}
+
+// writeFile writes b to a file called name in a temporary directory and
+// returns its path.
+func writeFile(t *testing.T, name string, b []byte) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestExitStatusUnreadable(t *testing.T) {
+	zip := writeFile(t, "a.zip", mustBuildFixture(t, selftestFiles))
+	missing := filepath.Join(t.TempDir(), "missing.zip")
+	for _, tc := range []struct {
+		name string
+		args []string
+	}{
+		{"missing", []string{missing}},
+		{"missing among others", []string{zip, missing}},
+		{"directory", []string{t.TempDir()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if out, status := runCommand(t, tc.args...); status != 6 {
+				t.Errorf("exit status %d, want 6\n%s", status, out)
+			}
+		})
+	}
+	if out, status := runCommand(t, zip); status != 0 {
+		t.Errorf("readable archive: exit status %d, want 0\n%s", status, out)
+	}
+}
+
+func TestExitStatusNotZip(t *testing.T) {
+	random := make([]byte, 64<<10)
+	rand.New(rand.NewSource(1)).Read(random)
+	// Make sure the noise doesn't happen to contain a signature.
+	random = bytes.ReplaceAll(random, []byte("P"), []byte("Q"))
+	for _, tc := range []struct {
+		name string
+		b    []byte
+	}{
+		{"text", []byte(strings.Repeat("This is not an archive.\n", 100))},
+		{"random", random},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, status := runCommand(t, writeFile(t, tc.name, tc.b))
+			if status != 3 {
+				t.Errorf("exit status %d, want 3\n%s", status, out)
+			}
+			if out != "no zip structure found\n" {
+				t.Errorf("got %q, want only the not-zip message", out)
+			}
+		})
+	}
+}
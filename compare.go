@@ -0,0 +1,132 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+)
+
+// Reconciliation compares the entries found by scanning with those
+// archive/zip lists, matched by data position.
+type Reconciliation struct {
+	// Both are the entries archive/zip lists as well, ScannerOnly the
+	// hidden or carved ones.
+	Both, ScannerOnly []FileHeader
+	// StdlibOnly are the files archive/zip lists whose local header the
+	// scanner missed.
+	StdlibOnly []StdlibFile
+}
+
+// StdlibFile is a file listed by archive/zip.
+type StdlibFile struct {
+	Name string
+	// Offset is the data position, -1 if archive/zip can't find the local
+	// header.
+	Offset int64
+}
+
+// reconcile matches headers against the files archive/zip lists for r.
+func reconcile(headers []FileHeader, r io.ReaderAt, size int64) (*Reconciliation, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("archive/zip: %w", err)
+	}
+	stdlib := make(map[int64]*zip.File, len(zr.File))
+	for _, zf := range zr.File {
+		if pos, err := zf.DataOffset(); err == nil {
+			stdlib[pos] = zf
+		}
+	}
+	var rec Reconciliation
+	for _, h := range headers {
+		if _, ok := stdlib[h.pos]; ok {
+			delete(stdlib, h.pos)
+			rec.Both = append(rec.Both, h)
+		} else {
+			rec.ScannerOnly = append(rec.ScannerOnly, h)
+		}
+	}
+	for _, zf := range zr.File {
+		pos, err := zf.DataOffset()
+		if err != nil {
+			rec.StdlibOnly = append(rec.StdlibOnly, StdlibFile{zf.Name, -1})
+		} else if stdlib[pos] == zf {
+			rec.StdlibOnly = append(rec.StdlibOnly, StdlibFile{zf.Name, pos})
+		}
+	}
+	return &rec, nil
+}
+
+// compareStdlib reconciles the entries found by scanning filename with
+// those archive/zip lists for it. It prints the entries both see, those
+// only the scanner finds, and those only archive/zip knows about.
+func compareStdlib(filename string, cfg *config, w io.Writer) error {
+	f, release, err := openInput(filename, cfg.spill)
+	if err != nil {
+		return err
+	}
+	defer release()
+	c := *cfg
+	c.hiddenOnly, c.only = false, nil
+	var scanned collector
+	var s Summary
+	if err := scanFileHeaders(f, &c, &scanned, &s); err != nil {
+		return err
+	}
+	rec, err := reconcile(scanned.headers, f, s.Size)
+	if err != nil {
+		return err
+	}
+
+	var both, scannerOnly, stdlibOnly []string
+	for _, h := range rec.Both {
+		line := fmt.Sprintf("%s at %d", h.name, h.pos)
+		if h.central != nil && h.central.name != h.name {
+			line += fmt.Sprintf(" (central name %s)", h.central.name)
+		}
+		both = append(both, line)
+	}
+	for _, h := range rec.ScannerOnly {
+		scannerOnly = append(scannerOnly, fmt.Sprintf("%s at %d", h.name, h.pos))
+	}
+	for _, zf := range rec.StdlibOnly {
+		if zf.Offset < 0 {
+			stdlibOnly = append(stdlibOnly, zf.Name+" (no local header)")
+		} else {
+			stdlibOnly = append(stdlibOnly, fmt.Sprintf("%s at %d", zf.Name, zf.Offset))
+		}
+	}
+
+	for _, group := range []struct {
+		title string
+		lines []string
+	}{
+		{"both", both},
+		{"scanner only", scannerOnly},
+		{"archive/zip only", stdlibOnly},
+	} {
+		if _, err := fmt.Fprintf(w, "%s (%d):\n", group.title, len(group.lines)); err != nil {
+			return err
+		}
+		for _, line := range group.lines {
+			if _, err := fmt.Fprintln(w, "  "+line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
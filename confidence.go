@@ -0,0 +1,126 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Confidence weights. The confidence of an entry is the sum of the points
+// it earns in each category, from 0 for noise to 100 for an entry that
+// looks entirely real:
+//
+//	chaining  40  listed in the central directory or followed by another
+//	              zip structure right after its data; 15 if the data at
+//	              least ends within the file
+//	name      20  scaled by the share of printable characters, 0 for a
+//	              name flagged UTF-8 that isn't
+//	method    20  a compression method defined by APPNOTE
+//	flags     20  no unused or reserved bits set, less 10 for those and 5
+//	              each for strong encryption without encryption and
+//	              compression options on a method that has none
+//
+// A timestamp zeroed to the MS-DOS epoch costs 5 points. Reproducible
+// builds write those too, so it is only a weak hint of a crafted archive.
+const (
+	confidenceChained  = 40
+	confidenceInFile   = 15
+	confidenceName     = 20
+	confidenceMethod   = 20
+	confidenceFlags    = 20
+	maxConfidence      = 100
+	unusedFlags        = 0x0080 | 0x0100 | 0x0200 | 0x0400 | 0x1000 | 0x4000 | 0x8000
+	unusedFlagsPenalty = 10
+	flagPenalty        = 5
+	zeroedTimePenalty  = 5
+)
+
+// confidence scores how likely h is a real entry in a file of the given
+// size. signals explain the points h didn't earn.
+func confidence(r io.ReaderAt, h *FileHeader, size int64) (score int, signals []string) {
+	switch {
+	case isChained(r, h, size):
+		score += confidenceChained
+	case h.pos+int64(h.csize) <= size:
+		score += confidenceInFile
+		signals = append(signals, "not chained to another zip structure")
+	default:
+		signals = append(signals, "data runs past the end of the file")
+	}
+	name := nameConfidence(h)
+	if name < confidenceName {
+		signals = append(signals, fmt.Sprintf("name scores %d of %d", name, confidenceName))
+	}
+	score += name
+	if knownMethods[h.compression] {
+		score += confidenceMethod
+	} else {
+		signals = append(signals, fmt.Sprintf("unknown compression method %d", h.compression))
+	}
+	flags, flagSignals := flagConfidence(h)
+	score += flags
+	signals = append(signals, flagSignals...)
+	if isZeroedTime(h) {
+		score -= zeroedTimePenalty
+		signals = append(signals, "timestamp zeroed to the MS-DOS epoch")
+	}
+	if score < 0 {
+		score = 0
+	}
+	return score, signals
+}
+
+// nameConfidence scores the share of printable characters in the name of
+// h.
+func nameConfidence(h *FileHeader) int {
+	if h.name == "" || h.flags&0x800 != 0 && !utf8.ValidString(h.name) {
+		return 0
+	}
+	printable, total := 0, 0
+	for _, r := range h.name {
+		total++
+		if r != utf8.RuneError && unicode.IsPrint(r) {
+			printable++
+		}
+	}
+	return confidenceName * printable / total
+}
+
+// flagConfidence scores whether the general purpose flags of h make sense
+// together.
+func flagConfidence(h *FileHeader) (int, []string) {
+	score := confidenceFlags
+	var signals []string
+	if h.flags&unusedFlags != 0 {
+		score -= unusedFlagsPenalty
+		signals = append(signals, fmt.Sprintf("unused flag bits %#04x set", h.flags&unusedFlags))
+	}
+	if h.flags&0x40 != 0 && h.flags&0x1 == 0 {
+		score -= flagPenalty
+		signals = append(signals, "strong encryption flagged without encryption")
+	}
+	if h.flags&0x6 != 0 {
+		switch h.compression {
+		case 6, 8, 9, 14:
+		default:
+			score -= flagPenalty
+			signals = append(signals, fmt.Sprintf("compression options set for method %d", h.compression))
+		}
+	}
+	return score, signals
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"io"
+	"strings"
+)
+
+// containerEntries is how many of the first entries are considered when
+// recognizing the container type.
+const containerEntries = 16
+
+// containerType recognizes zip based formats from the first entries of an
+// archive. It returns "" for plain zips.
+func containerType(first []*FileHeader) string {
+	has := func(prefix string) bool {
+		for _, h := range first {
+			if strings.HasPrefix(h.name, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(first) > 0 && first[0].name == "mimetype" {
+		// ODF and EPUB start with a stored entry naming the media type.
+		switch mime := readMimetype(first[0]); {
+		case mime == "application/epub+zip":
+			return "epub"
+		case strings.HasPrefix(mime, "application/vnd.oasis.opendocument."):
+			return "odf"
+		}
+	}
+	switch {
+	case has("[Content_Types].xml"):
+		switch {
+		case has("word/"):
+			return "ooxml/docx"
+		case has("xl/"):
+			return "ooxml/xlsx"
+		case has("ppt/"):
+			return "ooxml/pptx"
+		}
+		return "ooxml"
+	case has("AndroidManifest.xml") || has("classes.dex"):
+		return "apk"
+	case has("META-INF/MANIFEST.MF"):
+		return "jar"
+	}
+	return ""
+}
+
+// readMimetype returns the content of a short mimetype entry.
+func readMimetype(h *FileHeader) string {
+	rc, err := openEntry(h.src, h)
+	if err != nil {
+		return ""
+	}
+	defer rc.Close()
+	b, _ := io.ReadAll(io.LimitReader(rc, 256))
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,146 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// A Decompressor returns a reader that decompresses the data read from r,
+// like zip.Decompressor. Reads past the compressed data return io.EOF.
+type Decompressor func(r io.Reader) io.ReadCloser
+
+// decompressors maps compression methods to their Decompressor.
+var decompressors sync.Map
+
+func init() {
+	decompressors.Store(uint16(0), Decompressor(io.NopCloser))
+	decompressors.Store(uint16(8), Decompressor(flate.NewReader))
+}
+
+// RegisterDecompressor registers a Decompressor for a compression method,
+// which extraction, validation and hashing then use. Store (0) and deflate
+// (8) are built in. Like zip.RegisterDecompressor, it panics if the method
+// is already registered. For example, Zstandard (93) can be supported with
+// github.com/klauspost/compress/zstd:
+//
+//	RegisterDecompressor(93, func(r io.Reader) io.ReadCloser {
+//		d, _ := zstd.NewReader(r) // fails only for invalid options
+//		return d.IOReadCloser()
+//	})
+func RegisterDecompressor(method uint16, dcomp Decompressor) {
+	if _, dup := decompressors.LoadOrStore(method, dcomp); dup {
+		panic(fmt.Sprintf("decompressor for method %d already registered", method))
+	}
+}
+
+// decompressor returns the Decompressor for method, or nil.
+func decompressor(method uint16) Decompressor {
+	if d, ok := decompressors.Load(method); ok {
+		return d.(Decompressor)
+	}
+	return nil
+}
+
+// openEntry returns a reader for the decompressed content of h.
+func openEntry(r io.ReaderAt, h *FileHeader) (io.ReadCloser, error) {
+	if h.flags&0x8 != 0 && h.csize == 0 {
+		return nil, errors.New("entry size is only stored in the data descriptor")
+	}
+	data, method, err := rawData(r, h)
+	if err != nil {
+		return nil, err
+	}
+	dcomp := decompressor(method)
+	if dcomp == nil {
+		return nil, fmt.Errorf("unsupported compression method %s", methodName(method))
+	}
+	return budgeted(h, dcomp(data)), nil
+}
+
+// budgeted holds rc, the decompressed content of h, to the decompression
+// budget of h, if it has one.
+func budgeted(h *FileHeader, rc io.ReadCloser) io.ReadCloser {
+	if h.budget == nil {
+		return rc
+	}
+	return &budgetReader{rc: rc, b: h.budget, h: h}
+}
+
+// errDecompressionLimit stops decompression beyond -max-decompressed.
+var errDecompressionLimit = errors.New("decompression limit exceeded (possible bomb)")
+
+// decompressionBudget limits how much a single entry and all entries of an
+// archive together may decompress to.
+type decompressionBudget struct {
+	max  int64
+	used int64
+}
+
+// budgetReader fails once its entry or the archive exceeds the budget.
+// Hashing, validation and the other checks each decompress the same entry,
+// so the archive is only charged for the bytes of h that no earlier reader
+// got to. Without h, every byte is charged.
+type budgetReader struct {
+	rc io.ReadCloser
+	b  *decompressionBudget
+	h  *FileHeader
+	n  int64
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	r.n += int64(n)
+	r.charge(int64(n))
+	if r.n > r.b.max || atomic.LoadInt64(&r.b.used) > r.b.max {
+		return n, errDecompressionLimit
+	}
+	return n, err
+}
+
+// charge adds the n bytes just read to the archive total, less what was
+// already charged for the entry.
+func (r *budgetReader) charge(n int64) {
+	if r.h == nil {
+		atomic.AddInt64(&r.b.used, n)
+		return
+	}
+	for {
+		charged := atomic.LoadInt64(&r.h.charged)
+		if r.n <= charged {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&r.h.charged, charged, r.n) {
+			atomic.AddInt64(&r.b.used, r.n-charged)
+			return
+		}
+	}
+}
+
+func (r *budgetReader) Close() error {
+	return r.rc.Close()
+}
+
+// noteLimit warns about h if err is due to the decompression limit.
+func noteLimit(h *FileHeader, err error) {
+	if errors.Is(err, errDecompressionLimit) {
+		h.warnings = append(h.warnings, err.Error())
+	}
+}
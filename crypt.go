@@ -0,0 +1,264 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// winZipAESID is the extra field of WinZip AES encrypted entries, which
+// have compression method 99.
+const winZipAESID = 0x9901
+
+var errWrongPassword = errors.New("wrong password")
+
+// decryptionOK is the decryption result of entries the password fits.
+const decryptionOK = "ok"
+
+// checkPassword tries the password on the encrypted entry h, setting
+// h.decryption.
+func checkPassword(r io.ReaderAt, h *FileHeader) {
+	if h.flags&0x1 == 0 || h.password == "" {
+		return
+	}
+	if _, _, err := rawData(r, h); err != nil {
+		h.decryption = err.Error()
+		h.warnings = append(h.warnings, "decryption failed: "+err.Error())
+		return
+	}
+	h.decryption = decryptionOK
+}
+
+// rawData returns a reader for the compressed data of h, decrypting it
+// with h.password if the entry is encrypted, and the compression method
+// of the data.
+func rawData(r io.ReaderAt, h *FileHeader) (io.Reader, uint16, error) {
+	if h.flags&0x1 == 0 {
+		return io.NewSectionReader(r, h.pos, int64(h.csize)), h.compression, nil
+	}
+	if h.password == "" {
+		return nil, 0, errors.New("entry is encrypted")
+	}
+	if h.compression == 99 {
+		return winZipAESData(r, h)
+	}
+	if h.flags&0x40 != 0 {
+		return nil, 0, errors.New("strong encryption is not supported")
+	}
+	return zipCryptoData(r, h)
+}
+
+// zipCrypto is the traditional PKWARE encryption.
+type zipCrypto struct {
+	keys [3]uint32
+}
+
+func newZipCrypto(password string) *zipCrypto {
+	z := &zipCrypto{[3]uint32{0x12345678, 0x23456789, 0x34567890}}
+	for i := 0; i < len(password); i++ {
+		z.update(password[i])
+	}
+	return z
+}
+
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ crc>>8
+}
+
+func (z *zipCrypto) update(b byte) {
+	z.keys[0] = crc32Update(z.keys[0], b)
+	z.keys[1] = (z.keys[1]+z.keys[0]&0xff)*134775813 + 1
+	z.keys[2] = crc32Update(z.keys[2], byte(z.keys[1]>>24))
+}
+
+func (z *zipCrypto) decrypt(p []byte) {
+	for i, c := range p {
+		t := z.keys[2] | 2
+		c ^= byte(t * (t ^ 1) >> 8)
+		z.update(c)
+		p[i] = c
+	}
+}
+
+type zipCryptoReader struct {
+	r io.Reader
+	z *zipCrypto
+}
+
+func (zr *zipCryptoReader) Read(p []byte) (int, error) {
+	n, err := zr.r.Read(p)
+	zr.z.decrypt(p[:n])
+	return n, err
+}
+
+// zipCryptoData checks the password against the 12 byte encryption header,
+// whose last byte is the high byte of the CRC-32 or, with a data
+// descriptor, of the modification time.
+func zipCryptoData(r io.ReaderAt, h *FileHeader) (io.Reader, uint16, error) {
+	if h.csize < 12 {
+		return nil, 0, errors.New("encrypted entry too short")
+	}
+	var header [12]byte
+	if _, err := r.ReadAt(header[:], h.pos); err != nil {
+		return nil, 0, err
+	}
+	z := newZipCrypto(h.password)
+	z.decrypt(header[:])
+	check := byte(h.crc32 >> 24)
+	if h.flags&0x8 != 0 {
+		check = byte(h.mtime >> 8)
+	}
+	if header[11] != check {
+		return nil, 0, errWrongPassword
+	}
+	return &zipCryptoReader{io.NewSectionReader(r, h.pos+12, int64(h.csize)-12), z}, h.compression, nil
+}
+
+// winZipAES describes the AES encryption of an entry.
+type winZipAES struct {
+	// version 2 entries have no CRC-32.
+	version uint16
+	keyLen  int
+	saltLen int
+	method  uint16
+}
+
+func parseWinZipAES(extra []byte) (*winZipAES, error) {
+	data, ok := findExtra(extra, winZipAESID)
+	if !ok || len(data) < 7 || string(data[2:4]) != "AE" {
+		return nil, errors.New("missing AES extra field")
+	}
+	strength := int(data[4])
+	if strength < 1 || strength > 3 {
+		return nil, fmt.Errorf("invalid AES strength %d", strength)
+	}
+	return &winZipAES{
+		version: binary.LittleEndian.Uint16(data),
+		keyLen:  8 + 8*strength,
+		saltLen: 4 + 4*strength,
+		method:  binary.LittleEndian.Uint16(data[5:]),
+	}, nil
+}
+
+// winZipAESData decrypts WinZip AES entries: the data is preceded by a salt
+// and a password verifier and followed by a 10 byte HMAC-SHA1, which is
+// checked at the end of the data.
+func winZipAESData(r io.ReaderAt, h *FileHeader) (io.Reader, uint16, error) {
+	ae, err := parseWinZipAES(h.extra)
+	if err != nil {
+		return nil, 0, err
+	}
+	overhead := int64(ae.saltLen + 2 + 10)
+	if int64(h.csize) < overhead {
+		return nil, 0, errors.New("encrypted entry too short")
+	}
+	head := make([]byte, ae.saltLen+2)
+	if _, err := r.ReadAt(head, h.pos); err != nil {
+		return nil, 0, err
+	}
+	keys := pbkdf2([]byte(h.password), head[:ae.saltLen], 1000, 2*ae.keyLen+2, sha1.New)
+	if !hmac.Equal(keys[2*ae.keyLen:], head[ae.saltLen:]) {
+		return nil, 0, errWrongPassword
+	}
+	block, err := aes.NewCipher(keys[:ae.keyLen])
+	if err != nil {
+		return nil, 0, err
+	}
+	n := int64(h.csize) - overhead
+	var auth [10]byte
+	if _, err := r.ReadAt(auth[:], h.pos+int64(len(head))+n); err != nil {
+		return nil, 0, err
+	}
+	return &aesReader{
+		r:     io.NewSectionReader(r, h.pos+int64(len(head)), n),
+		block: block,
+		mac:   hmac.New(sha1.New, keys[ae.keyLen:2*ae.keyLen]),
+		auth:  auth,
+		ctr:   [aes.BlockSize]byte{1},
+	}, ae.method, nil
+}
+
+// aesReader decrypts AES in counter mode with the little-endian counter
+// WinZip uses and authenticates the ciphertext.
+type aesReader struct {
+	r     io.Reader
+	block cipher.Block
+	mac   hash.Hash
+	auth  [10]byte
+
+	ctr    [aes.BlockSize]byte
+	stream [aes.BlockSize]byte
+	used   int
+}
+
+func (a *aesReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	a.mac.Write(p[:n])
+	for i := range p[:n] {
+		if a.used == 0 || a.used == aes.BlockSize {
+			a.block.Encrypt(a.stream[:], a.ctr[:])
+			for j := range a.ctr {
+				a.ctr[j]++
+				if a.ctr[j] != 0 {
+					break
+				}
+			}
+			a.used = 0
+		}
+		p[i] ^= a.stream[a.used]
+		a.used++
+	}
+	if err == io.EOF && !hmac.Equal(a.mac.Sum(nil)[:10], a.auth[:]) {
+		return n, errors.New("AES authentication failed")
+	}
+	return n, err
+}
+
+// pbkdf2 derives a key from password as in RFC 8018.
+func pbkdf2(password, salt []byte, iter, keyLen int, h func() hash.Hash) []byte {
+	prf := hmac.New(h, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+	var buf [4]byte
+	dk := make([]byte, 0, blocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for x := range u {
+				t[x] ^= u[x]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
@@ -0,0 +1,124 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// diffArchives compares the entries of newName against those of oldName by
+// name and content hash. Entries whose content couldn't be hashed in either
+// archive are listed as unverified.
+func diffArchives(oldName, newName string, cfg *config, w io.Writer) error {
+	var olds, news collector
+	if err := searchFileHeaders(oldName, cfg, &olds); err != nil {
+		return fmt.Errorf("%s: %w", oldName, err)
+	}
+	if err := searchFileHeaders(newName, cfg, &news); err != nil {
+		return fmt.Errorf("%s: %w", newName, err)
+	}
+	oldHashes, newHashes := hashesByName(olds.headers), hashesByName(news.headers)
+	oldNames, newNames := namesByHash(olds.headers), namesByHash(news.headers)
+
+	var lines []string
+	for name, sums := range newHashes {
+		old, ok := oldHashes[name]
+		switch {
+		case !ok:
+			if from := renamedFrom(sums, oldNames, newHashes); from != "" {
+				lines = append(lines, fmt.Sprintf("renamed %s -> %s", from, name))
+			} else {
+				lines = append(lines, "added "+name)
+			}
+		case missingHash(old) || missingHash(sums):
+			// Content that couldn't be hashed can't be compared.
+			lines = append(lines, "unverified "+name)
+		case old != sums:
+			lines = append(lines, "changed "+name)
+		}
+	}
+	for name, sums := range oldHashes {
+		if _, ok := newHashes[name]; ok {
+			continue
+		}
+		if renamedFrom(sums, newNames, oldHashes) == "" {
+			lines = append(lines, "removed "+name)
+		}
+	}
+	// Sort by name rather than by operation.
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i][strings.IndexByte(lines[i], ' '):] < lines[j][strings.IndexByte(lines[j], ' '):]
+	})
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashesByName maps entry names to their content hashes. Names appearing
+// more than once map to all of their hashes.
+func hashesByName(headers []FileHeader) map[string]string {
+	m := make(map[string][]string)
+	for _, h := range headers {
+		m[h.name] = append(m[h.name], h.hash)
+	}
+	r := make(map[string]string, len(m))
+	for name, sums := range m {
+		sort.Strings(sums)
+		r[name] = strings.Join(sums, ",")
+	}
+	return r
+}
+
+// missingHash reports whether any of the comma-separated hashes of
+// hashesByName is missing.
+func missingHash(sums string) bool {
+	for _, sum := range strings.Split(sums, ",") {
+		if sum == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// namesByHash maps content hashes to the first entry name with that hash.
+func namesByHash(headers []FileHeader) map[string]string {
+	r := make(map[string]string)
+	for _, h := range headers {
+		if _, ok := r[h.hash]; h.hash != "" && !ok {
+			r[h.hash] = h.name
+		}
+	}
+	return r
+}
+
+// renamedFrom returns the name of an entry in the other archive with the
+// same content, as long as that name doesn't exist in this archive anymore.
+func renamedFrom(sums string, otherNames map[string]string, hashes map[string]string) string {
+	if sums == "" || strings.Contains(sums, ",") {
+		return ""
+	}
+	if name, ok := otherNames[sums]; ok {
+		if _, exists := hashes[name]; !exists {
+			return name
+		}
+	}
+	return ""
+}
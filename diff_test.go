@@ -0,0 +1,84 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setMethod sets the compression method of every header and central
+// directory record of the archive in b.
+func setMethod(b []byte, method uint16) []byte {
+	b = append([]byte(nil), b...)
+	for _, sig := range []struct {
+		magic string
+		off   int
+	}{{"PK\x03\x04", 8}, {"PK\x01\x02", 10}} {
+		for i := 0; ; i++ {
+			j := bytes.Index(b[i:], []byte(sig.magic))
+			if j < 0 {
+				break
+			}
+			i += j
+			binary.LittleEndian.PutUint16(b[i+sig.off:], method)
+		}
+	}
+	return b
+}
+
+func TestDiffArchives(t *testing.T) {
+	files := []fixtureFile{{name: "a.txt", content: []byte("a"), method: zip.Store}}
+	changed := []fixtureFile{{name: "a.txt", content: []byte("b"), method: zip.Store}}
+	plain := mustBuildFixture(t, files)
+	// No decompressor is registered for bzip2, so there is no hash.
+	bzip2 := setMethod(plain, 12)
+	for _, tc := range []struct {
+		name     string
+		old, new []byte
+		want     string
+	}{
+		{"same", plain, plain, ""},
+		{"changed", plain, mustBuildFixture(t, changed), "changed a.txt\n"},
+		{"unhashable", bzip2, bzip2, "unverified a.txt\n"},
+		{"unhashable on one side", plain, bzip2, "unverified a.txt\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			oldName := filepath.Join(dir, "old.zip")
+			newName := filepath.Join(dir, "new.zip")
+			if err := os.WriteFile(oldName, tc.old, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(newName, tc.new, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			cfg := newConfig(nil)
+			cfg.hash = true
+			var out strings.Builder
+			if err := diffArchives(oldName, newName, cfg, &out); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tc.want {
+				t.Errorf("got %q, want %q", out.String(), tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Command hidden_zip finds hidden files in a Zip archive by looking for
+// local file headers instead of trusting the central directory.
+//
+// Usage:
+//
+//	hidden_zip [options] <file.zip|->...
+//
+// Every local file header found is printed with its name, the position of
+// its data and its uncompressed size. See hidden_zip -h for the options.
+//
+// The search for local file headers always covers the whole file, so
+// archives appended to each other or embedded in other files are found as
+// well. Like archive/zip, the comparison with the central directory (e.g.
+// for -hidden-only) uses the last end of central directory record in the
+// file, so entries of earlier archives count as hidden. With -stop-at-eocd,
+// the scan ends with the first complete archive instead and all features
+// refer to that one.
+//
+// The scanner can also be used on any io.ReaderAt, for example an archive
+// held in memory:
+//
+//	headers, err := ScanReaderAt(bytes.NewReader(b), int64(len(b)), WithHash())
+//	if err != nil {
+//		return err
+//	}
+//	for _, h := range headers {
+//		fmt.Println(h.name, h.hash)
+//	}
+//
+// Sources that can only seek, like an io.ReadSeeker without ReadAt, are
+// adapted with ReaderAtFromSeeker first:
+//
+//	r, size, err := ReaderAtFromSeeker(rs)
+//	if err != nil {
+//		return err
+//	}
+//	headers, err := ScanReaderAt(r, size, WithHash())
+//
+// Analyze returns a Result that adds the gaps between structures, the
+// concatenated archive segments and a comparison with archive/zip to the
+// entries and summary.
+//
+// Walk and, with Go 1.23, the Headers iterator report headers as they are
+// found instead, so a caller can stop early:
+//
+//	for h, err := range Headers(f, size) {
+//		if err != nil {
+//			return err
+//		}
+//		if h.hidden {
+//			break
+//		}
+//	}
+//
+// Built with GOOS=js GOARCH=wasm, the program instead defines a global
+// JavaScript function scan(Uint8Array) that returns the entries, gaps,
+// segments and summary of the file as an object.
+package main
@@ -0,0 +1,92 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// defaultEntropyThreshold is the entropy above which -entropy flags an
+// entry. Compressed and encrypted data come close to 8 bits per byte, text
+// stays below 5.
+const defaultEntropyThreshold = 7.5
+
+// byteCounts counts the bytes written to it to compute their entropy.
+type byteCounts struct {
+	counts [256]int64
+	n      int64
+}
+
+func (c *byteCounts) Write(p []byte) (int, error) {
+	for _, b := range p {
+		c.counts[b]++
+	}
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// entropy returns the Shannon entropy of the bytes written in bits per
+// byte.
+func (c *byteCounts) entropy() float64 {
+	e := 0.0
+	for _, n := range c.counts {
+		if n > 0 {
+			p := float64(n) / float64(c.n)
+			e -= p * math.Log2(p)
+		}
+	}
+	return e
+}
+
+// entropy returns the Shannon entropy of b in bits per byte.
+func entropy(b []byte) float64 {
+	var c byteCounts
+	c.Write(b)
+	return c.entropy()
+}
+
+// maxEntropy is the highest entropy n bytes can have.
+func maxEntropy(n int) float64 {
+	if n > 256 {
+		n = 256
+	}
+	if n < 2 {
+		return 0
+	}
+	return math.Log2(float64(n))
+}
+
+// checkEntropy computes the entropy of the decompressed content of h and
+// warns if it exceeds threshold. Entries that can't be decompressed are
+// left out.
+func checkEntropy(r io.ReaderAt, h *FileHeader, threshold float64) {
+	rc, err := openEntry(r, h)
+	if err != nil {
+		return
+	}
+	defer rc.Close()
+	var c byteCounts
+	if _, err := io.Copy(&c, rc); err != nil || c.n == 0 {
+		noteLimit(h, err)
+		return
+	}
+	e := c.entropy()
+	h.entropy = &e
+	if e > threshold {
+		h.warnings = append(h.warnings, fmt.Sprintf("high entropy %.2f bits/byte, packed or encrypted content", e))
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// exampleArchive returns the archive of the self-test, which lists
+// readme.txt and data.txt in its central directory but also has a local
+// header for payload.bin.
+func exampleArchive() []byte {
+	b, err := buildFixture(selftestFiles)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func ExampleScanReaderAt() {
+	r := bytes.NewReader(exampleArchive())
+	headers, err := ScanReaderAt(r, r.Size())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, h := range headers {
+		fmt.Println(h.name, h.pos, h.size, h.hidden)
+	}
+	// Output:
+	// readme.txt 40 21 false
+	// payload.bin 102 580 true
+	// data.txt 178 1000 false
+}
+
+func ExampleWalk() {
+	r := bytes.NewReader(exampleArchive())
+	err := Walk(r, r.Size(), func(h FileHeader) error {
+		if h.hidden {
+			fmt.Println("hidden:", h.name)
+			return SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// hidden: payload.bin
+}
+
+func ExampleAnalyze() {
+	r := bytes.NewReader(exampleArchive())
+	res, err := Analyze(r, r.Size(), WithHash())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("entries:", res.Summary.Entries, "hidden:", res.Summary.Hidden)
+	fmt.Println("segments:", res.Segments)
+	for _, h := range res.Central.ScannerOnly {
+		fmt.Println("not in the central directory:", h.name, h.hash)
+	}
+	// Output:
+	// entries: 3 hidden: 1
+	// segments: [{0 331}]
+	// not in the central directory: payload.bin 139e81f30688a1136a8ab98ef10928bc5012748f2206576f3239cf2f3e4b1e35
+}
@@ -0,0 +1,38 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import "fmt"
+
+// notableRatio is the compression ratio from which -explain mentions it.
+const notableRatio = 100
+
+// explain collects the signals behind the class and confidence of h for
+// -explain, given the signals of its confidence score. Warnings are
+// included, as they make an entry suspicious.
+func explain(h *FileHeader, signals []string) []string {
+	var reasons []string
+	if h.hidden {
+		reasons = append(reasons, "not in central directory")
+	}
+	reasons = append(reasons, h.phantomReasons...)
+	if h.compression != 0 && h.csize > 0 {
+		if r := ratio(h); r >= notableRatio {
+			reasons = append(reasons, fmt.Sprintf("compression ratio %.0f:1", r))
+		}
+	}
+	reasons = append(reasons, signals...)
+	return append(reasons, h.warnings...)
+}
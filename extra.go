@@ -0,0 +1,187 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Extra field IDs.
+const (
+	zip64ExtraID        = 0x0001
+	extendedTimestampID = 0x5455
+	infoZIPUnixID       = 0x5855
+	unixOwnerID         = 0x7875
+	jarMarkerID         = 0xcafe
+	zipalignID          = 0xd935
+)
+
+// knownExtraIDs are the extra field IDs defined by APPNOTE or in common use.
+var knownExtraIDs = map[uint16]bool{
+	0x0001: true, 0x0007: true, 0x0008: true, 0x0009: true, 0x000a: true, 0x000c: true,
+	0x000d: true, 0x000e: true, 0x000f: true, 0x0014: true, 0x0015: true, 0x0016: true,
+	0x0017: true, 0x0018: true, 0x0019: true, 0x0020: true, 0x0021: true, 0x0022: true,
+	0x0023: true, 0x0065: true, 0x0066: true, 0x4690: true, 0x07c8: true, 0x2605: true,
+	0x2705: true, 0x2805: true, 0x334d: true, 0x4341: true, 0x4453: true, 0x4704: true,
+	0x470f: true, 0x4b46: true, 0x4c41: true, 0x4d49: true, 0x4f4c: true, 0x5356: true,
+	0x5455: true, 0x554e: true, 0x5855: true, 0x6375: true, 0x6542: true, 0x7075: true,
+	0x756e: true, 0x7855: true, 0x7875: true, 0x9901: true, 0xa11e: true, 0xa220: true,
+	0xfd4a: true, 0xcafe: true, 0xd935: true,
+}
+
+// Thresholds for suspicious extra fields: fields larger than
+// largeExtraField bytes, and unknown fields of at least entropyMinExtra
+// bytes whose entropy is above highEntropyRatio of the maximum.
+const (
+	largeExtraField  = 128
+	entropyMinExtra  = 16
+	highEntropyRatio = 0.9
+)
+
+// extraField is a single field of an extra block.
+type extraField struct {
+	id   uint16
+	data []byte
+}
+
+// parseExtra splits an extra block into its fields. A truncated last field
+// is returned with the available data.
+func parseExtra(extra []byte) []extraField {
+	var fields []extraField
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		n := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if n > len(extra) {
+			n = len(extra)
+		}
+		fields = append(fields, extraField{id, extra[:n]})
+		extra = extra[n:]
+	}
+	return fields
+}
+
+// findExtra returns the data of the first extra field with the given id.
+func findExtra(extra []byte, id uint16) ([]byte, bool) {
+	for _, f := range parseExtra(extra) {
+		if f.id == id {
+			return f.data, true
+		}
+	}
+	return nil, false
+}
+
+// extendedModTime returns the modification time from an extended
+// timestamp extra field.
+func extendedModTime(extra []byte) (time.Time, bool) {
+	data, ok := findExtra(extra, extendedTimestampID)
+	// Flags byte, then the times that are present in order.
+	if !ok || len(data) < 5 || data[0]&0x1 == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(int32(binary.LittleEndian.Uint32(data[1:]))), 0), true
+}
+
+// infoZIPUnix parses the old Info-ZIP Unix extra field: access and
+// modification time, followed by 16 bit UID and GID in local headers only.
+func infoZIPUnix(extra []byte) (mtime time.Time, o *owner, ok bool) {
+	data, ok := findExtra(extra, infoZIPUnixID)
+	if !ok || len(data) < 8 {
+		return time.Time{}, nil, false
+	}
+	mtime = time.Unix(int64(int32(binary.LittleEndian.Uint32(data[4:]))), 0)
+	if len(data) >= 12 {
+		o = &owner{uint64(binary.LittleEndian.Uint16(data[8:])), uint64(binary.LittleEndian.Uint16(data[10:]))}
+	}
+	return mtime, o, true
+}
+
+// owner is the Unix UID and GID of an entry.
+type owner struct {
+	uid, gid uint64
+}
+
+// unixOwner parses the Info-ZIP "new Unix" extra field: a version byte,
+// then UID and GID, each preceded by its size in bytes.
+func unixOwner(extra []byte) (*owner, bool) {
+	data, ok := findExtra(extra, unixOwnerID)
+	if !ok || len(data) < 1 || data[0] != 1 {
+		return nil, false
+	}
+	data = data[1:]
+	var ids [2]uint64
+	for i := range ids {
+		if len(data) < 1 {
+			return nil, false
+		}
+		n := int(data[0])
+		if n > 8 || len(data) < 1+n {
+			return nil, false
+		}
+		var b [8]byte
+		copy(b[:], data[1:1+n])
+		ids[i] = binary.LittleEndian.Uint64(b[:])
+		data = data[1+n:]
+	}
+	return &owner{ids[0], ids[1]}, true
+}
+
+// isPadding reports whether f only pads the header, e.g. to align the entry
+// data for memory mapping: zero-filled, possibly after the alignment that
+// zipalign records.
+func isPadding(f extraField) bool {
+	data := f.data
+	switch {
+	case f.id == zipalignID && len(data) >= 2:
+		data = data[2:]
+	case f.id != jarMarkerID && knownExtraIDs[f.id]:
+		return false
+	}
+	for _, c := range data {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// checkExtra warns about extra fields that may hide data: unusually large
+// ones and unknown ones with high-entropy content. Padding is benign and
+// only noted if it doesn't align the data.
+func checkExtra(h *FileHeader) {
+	for _, f := range parseExtra(h.extra) {
+		if isPadding(f) {
+			// zipalign records the alignment, 4 bytes is the usual one.
+			align := int64(4)
+			if f.id == zipalignID && len(f.data) >= 2 && binary.LittleEndian.Uint16(f.data) > 0 {
+				align = int64(binary.LittleEndian.Uint16(f.data))
+			}
+			if len(f.data) > 0 && h.pos%align != 0 {
+				h.warnings = append(h.warnings, fmt.Sprintf("extra field 0x%04x pads %d bytes without aligning the data to %d", f.id, len(f.data), align))
+			}
+			continue
+		}
+		if len(f.data) > largeExtraField {
+			h.warnings = append(h.warnings, fmt.Sprintf("extra field 0x%04x unusually large: %d bytes", f.id, len(f.data)))
+		}
+		if !knownExtraIDs[f.id] && len(f.data) >= entropyMinExtra {
+			if e := entropy(f.data); e >= highEntropyRatio*maxEntropy(len(f.data)) {
+				h.warnings = append(h.warnings, fmt.Sprintf("unknown extra field 0x%04x holds %d bytes of high-entropy data (%.1f bits/byte)", f.id, len(f.data), e))
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// extractor writes the decompressed content of entries to files below dir.
+// It is safe for concurrent use.
+type extractor struct {
+	dir string
+	// sanitize rewrites names that would end up outside of dir instead of
+	// skipping the entry.
+	sanitize bool
+	// hiddenOnly skips the entries archive/zip lists.
+	hiddenOnly bool
+
+	mu    sync.Mutex
+	names uniqueNames
+}
+
+func newExtractor(dir string, sanitize bool) *extractor {
+	return &extractor{dir: dir, sanitize: sanitize, names: make(uniqueNames)}
+}
+
+func (e *extractor) write(h *FileHeader) error {
+	if e.hiddenOnly && !h.hidden {
+		return nil
+	}
+	name := sanitizeName(h.name)
+	if name != h.name {
+		if !e.sanitize {
+			return errors.New("unsafe name, use -sanitize to rewrite it")
+		}
+		fmt.Fprintf(os.Stderr, "sanitized %q to %q\n", h.name, name)
+	}
+	e.mu.Lock()
+	name = e.names.get(name)
+	e.mu.Unlock()
+	target := filepath.Join(e.dir, filepath.FromSlash(name))
+	if strings.HasSuffix(name, "/") {
+		return os.MkdirAll(target, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	rc, err := openEntry(h.src, h)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, rc); err != nil {
+		// Don't leave partial content behind.
+		f.Close()
+		os.Remove(target)
+		return err
+	}
+	return f.Close()
+}
+
+// sanitizeName turns an entry name into a relative slash-separated path
+// that can't leave the extraction directory: backslashes become slashes,
+// drive letters and leading slashes are dropped, and ".." components are
+// resolved.
+func sanitizeName(name string) string {
+	dir := strings.HasSuffix(name, "/") || strings.HasSuffix(name, "\\")
+	p := strings.ReplaceAll(name, "\\", "/")
+	if len(p) >= 2 && p[1] == ':' {
+		p = p[2:]
+	}
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		p = "_"
+	}
+	if dir {
+		p += "/"
+	}
+	return p
+}
+
+// errCatDone stops the scan once catEntry has found its entry.
+var errCatDone = errors.New("entry written")
+
+// catEntry writes the decompressed content of the first entry called name
+// in filename to w.
+func catEntry(filename, name string, cfg *config, w io.Writer) error {
+	f, release, err := openInput(filename, cfg.spill)
+	if err != nil {
+		return err
+	}
+	defer release()
+	var s Summary
+	err = scanFileHeaders(f, cfg.withBudget(), walkReporter(func(h FileHeader) error {
+		if h.name != name {
+			return nil
+		}
+		rc, err := openEntry(h.src, &h)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		if _, err := io.Copy(w, rc); err != nil {
+			return err
+		}
+		return errCatDone
+	}), &s)
+	switch err {
+	case errCatDone:
+		return nil
+	case nil:
+		return fmt.Errorf("%s: no entry %q", filename, name)
+	}
+	return fmt.Errorf("%s: %w", filename, err)
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// field is an entry attribute that -fields can select.
+type field struct {
+	name  string
+	value func(h *FileHeader) string
+}
+
+// entryFields lists the selectable fields. Offsets are data positions as
+// in the default output, header_offset is the position of the local header.
+var entryFields = []field{
+	{"name", func(h *FileHeader) string { return h.name }},
+	{"offset", func(h *FileHeader) string { return strconv.FormatInt(h.pos, 10) }},
+	{"header_offset", func(h *FileHeader) string { return strconv.FormatInt(h.headerPos(), 10) }},
+	{"size", func(h *FileHeader) string { return strconv.FormatUint(uint64(h.size), 10) }},
+	{"csize", func(h *FileHeader) string { return strconv.FormatUint(uint64(h.csize), 10) }},
+	{"crc32", func(h *FileHeader) string { return fmt.Sprintf("%08x", h.crc32) }},
+	{"method", func(h *FileHeader) string { return strconv.Itoa(int(h.compression)) }},
+	{"version", func(h *FileHeader) string { return strconv.Itoa(int(h.version)) }},
+	{"flags", func(h *FileHeader) string { return fmt.Sprintf("%#04x", h.flags) }},
+	{"modified", func(h *FileHeader) string { return h.modTime.Format(time.RFC3339) }},
+	{"sha256", func(h *FileHeader) string { return h.hash }},
+	{"integrity", func(h *FileHeader) string { return h.integrity }},
+	{"inner_signatures", func(h *FileHeader) string { return strconv.Itoa(h.innerSignatures) }},
+	{"class", func(h *FileHeader) string { return h.class }},
+	{"entropy", func(h *FileHeader) string {
+		if h.entropy == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*h.entropy, 'f', 2, 64)
+	}},
+	{"confidence", func(h *FileHeader) string { return strconv.Itoa(h.confidence) }},
+	{"directory", func(h *FileHeader) string { return strconv.FormatBool(h.IsDir()) }},
+	{"hidden", func(h *FileHeader) string { return strconv.FormatBool(h.hidden) }},
+	{"warnings", func(h *FileHeader) string { return strings.Join(h.warnings, "; ") }},
+}
+
+// parseFields looks up a comma-separated list of field names.
+func parseFields(spec string) ([]field, error) {
+	var fields []field
+outer:
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		for _, f := range entryFields {
+			if f.name == name {
+				fields = append(fields, f)
+				continue outer
+			}
+		}
+		names := make([]string, len(entryFields))
+		for i, f := range entryFields {
+			names[i] = f.name
+		}
+		return nil, fmt.Errorf("unknown field %q, valid fields: %s", name, strings.Join(names, ", "))
+	}
+	return fields, nil
+}
+
+// fieldValues returns the values of fields for h, passed through escape if
+// it isn't nil.
+func fieldValues(fields []field, h *FileHeader, escape func(string) string) []string {
+	values := make([]string, len(fields))
+	for i, f := range fields {
+		values[i] = f.value(h)
+		if escape != nil {
+			values[i] = escape(values[i])
+		}
+	}
+	return values
+}
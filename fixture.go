@@ -0,0 +1,135 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// fixtureFile describes an entry of a fixture archive.
+type fixtureFile struct {
+	name    string
+	content []byte
+	// method is zip.Store or zip.Deflate.
+	method uint16
+	// hidden entries only have a local header and are left out of the
+	// central directory.
+	hidden bool
+}
+
+// Fixture entries all get the same MS-DOS timestamp, 2022-07-30 12:00:00,
+// and no extra fields, so built archives don't depend on the host or the
+// time they were built at.
+const (
+	fixtureTime = 12 << 11
+	fixtureDate = (2022-1980)<<9 | 7<<5 | 30
+)
+
+// buildFixture builds an archive with the given entries. The same input
+// always results in the same bytes.
+func buildFixture(files []fixtureFile) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	hidden := make(map[string]bool)
+	for _, f := range files {
+		data, err := fixtureData(f)
+		if err != nil {
+			return nil, err
+		}
+		w, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               f.name,
+			Method:             f.method,
+			CreatorVersion:     20,
+			ReaderVersion:      20,
+			ModifiedTime:       fixtureTime,
+			ModifiedDate:       fixtureDate,
+			CRC32:              crc32.ChecksumIEEE(f.content),
+			CompressedSize64:   uint64(len(data)),
+			UncompressedSize64: uint64(len(f.content)),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if f.hidden {
+			hidden[f.name] = true
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	if len(hidden) == 0 {
+		return buf.Bytes(), nil
+	}
+	return hideEntries(buf.Bytes(), hidden)
+}
+
+// fixtureData returns the compressed content of f.
+func fixtureData(f fixtureFile) ([]byte, error) {
+	switch f.method {
+	case zip.Store:
+		return f.content, nil
+	case zip.Deflate:
+		var buf bytes.Buffer
+		fw, err := flate.NewWriter(&buf, flate.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fw.Write(f.content); err != nil {
+			return nil, err
+		}
+		if err := fw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, errors.New("unsupported fixture compression method")
+}
+
+// hideEntries removes the named entries from the central directory of the
+// archive in b, leaving their local headers in place.
+func hideEntries(b []byte, names map[string]bool) ([]byte, error) {
+	r := bytes.NewReader(b)
+	cd, err := readCentralDirectory(r, r.Size())
+	if err != nil {
+		return nil, err
+	}
+	out := append([]byte(nil), b[:cd.pos]...)
+	dir := b[cd.pos : cd.pos+cd.size]
+	kept := 0
+	for len(dir) > 0 {
+		rec, n, err := parseCentralRecord(dir)
+		if err != nil {
+			return nil, err
+		}
+		if !names[rec.name] {
+			out = append(out, dir[:n]...)
+			kept++
+		}
+		dir = dir[n:]
+	}
+	eocd := append([]byte(nil), b[cd.eocdPos:]...)
+	binary.LittleEndian.PutUint16(eocd[8:], uint16(kept))
+	binary.LittleEndian.PutUint16(eocd[10:], uint16(kept))
+	binary.LittleEndian.PutUint32(eocd[12:], uint32(len(out))-uint32(cd.pos))
+	return append(out, eocd...), nil
+}
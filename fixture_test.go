@@ -0,0 +1,62 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// mustBuildFixture is buildFixture for tests, failing t on errors.
+func mustBuildFixture(t testing.TB, files []fixtureFile) []byte {
+	t.Helper()
+	b, err := buildFixture(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestBuildFixtureIsDeterministic(t *testing.T) {
+	a := mustBuildFixture(t, selftestFiles)
+	b := mustBuildFixture(t, selftestFiles)
+	if !bytes.Equal(a, b) {
+		t.Error("building the same fixture twice gave different archives")
+	}
+}
+
+func TestBuildFixtureHidesEntries(t *testing.T) {
+	b := mustBuildFixture(t, selftestFiles)
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listed []string
+	for _, f := range zr.File {
+		listed = append(listed, f.Name)
+	}
+	if got := strings.Join(listed, ","); got != "readme.txt,data.txt" {
+		t.Errorf("archive/zip lists %s, want readme.txt,data.txt", got)
+	}
+}
+
+func TestSelftest(t *testing.T) {
+	var out strings.Builder
+	if !selftest(&out) {
+		t.Error(out.String())
+	}
+}
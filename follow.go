@@ -0,0 +1,76 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// followPoll is how often -follow checks whether the file grew.
+const followPoll = 500 * time.Millisecond
+
+// followFileHeaders scans filename like scanFileHeaders, then keeps
+// scanning the data appended to it until it hasn't grown for idle. Every
+// round resumes after the last header found, so entries are reported once.
+func followFileHeaders(filename string, cfg *config, rep reporter, s *Summary, idle time.Duration) error {
+	if filename == "-" {
+		return errors.New("-follow needs a file")
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return newOpenError(filename, err)
+	}
+	defer f.Close()
+
+	round := *cfg
+	round.checkpoint = nil
+	// total collects the entries found by all rounds.
+	var total, first Summary
+	scanned := int64(-1)
+	grown := time.Now()
+	for {
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if size := fi.Size(); size != scanned {
+			*s = Summary{}
+			err := scanFileHeaders(io.NewSectionReader(f, 0, size), &round, rep, s)
+			total.merge(s, "")
+			if err != nil {
+				return err
+			}
+			if scanned < 0 {
+				first = *s
+			}
+			if s.resume > round.start {
+				round.start = s.resume
+			}
+			scanned, grown = size, time.Now()
+		} else if time.Since(grown) >= idle {
+			break
+		}
+		time.Sleep(followPoll)
+	}
+	// Later rounds start where the previous one stopped, which isn't worth
+	// reporting.
+	s.Start, s.Skipped = first.Start, first.Skipped
+	s.Entries, s.Suppressed, s.Hidden, s.Phantom, s.Chained = total.Entries, total.Suppressed, total.Hidden, total.Phantom, total.Chained
+	s.Warnings, s.PhantomCentral = total.Warnings, total.PhantomCentral
+	return nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// groupKeys name the lenses of -group-by. Each returns the group of an
+// entry and, for a fixed set of groups, their order.
+var groupKeys = map[string]struct {
+	group func(h *FileHeader) string
+	order []string
+}{
+	"method": {group: func(h *FileHeader) string {
+		if name, ok := methodNames[h.compression]; ok {
+			return fmt.Sprintf("%d %s", h.compression, name)
+		}
+		return strconv.Itoa(int(h.compression))
+	}},
+	"dir": {group: func(h *FileHeader) string {
+		if i := strings.IndexByte(h.name, '/'); i >= 0 {
+			return h.name[:i+1]
+		}
+		return "."
+	}},
+	"status": {
+		group: func(h *FileHeader) string { return h.class },
+		order: []string{classNormal, classHidden, classPhantom, classUnknown},
+	},
+}
+
+// groupReporter lists the entries grouped by key once the scan is done,
+// each group headed by its subtotals.
+type groupReporter struct {
+	w      io.Writer
+	text   *textReporter
+	group  func(h *FileHeader) string
+	order  []string
+	groups map[string][]*FileHeader
+}
+
+func newGroupReporter(w io.Writer, text *textReporter, key string) (*groupReporter, error) {
+	k, ok := groupKeys[key]
+	if !ok {
+		return nil, fmt.Errorf("invalid -group-by %q, want method, dir or status", key)
+	}
+	return &groupReporter{w: w, text: text, group: k.group, order: k.order}, nil
+}
+
+func (g *groupReporter) entry(h *FileHeader) error {
+	if g.groups == nil {
+		g.groups = make(map[string][]*FileHeader)
+	}
+	c := *h
+	key := g.group(&c)
+	g.groups[key] = append(g.groups[key], &c)
+	return nil
+}
+
+func (g *groupReporter) summary(s *Summary) error {
+	order := g.order
+	if order == nil {
+		for key := range g.groups {
+			order = append(order, key)
+		}
+		sort.Strings(order)
+	}
+	for _, key := range order {
+		entries := g.groups[key]
+		var size, csize uint64
+		for _, h := range entries {
+			size += uint64(h.size)
+			csize += uint64(h.csize)
+		}
+		if _, err := fmt.Fprintf(g.w, "%s (%s, size %d, csize %d):\n", key, countEntries(len(entries)), size, csize); err != nil {
+			return err
+		}
+		for _, h := range entries {
+			if _, err := io.WriteString(g.w, "  "); err != nil {
+				return err
+			}
+			if err := g.text.entry(h); err != nil {
+				return err
+			}
+		}
+	}
+	g.groups = nil
+	return g.text.summary(s)
+}
+
+// countEntries returns "1 entry" or "n entries".
+func countEntries(n int) string {
+	if n == 1 {
+		return "1 entry"
+	}
+	return fmt.Sprintf("%d entries", n)
+}
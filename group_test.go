@@ -0,0 +1,41 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGroupHeadings(t *testing.T) {
+	var out strings.Builder
+	g, err := newGroupReporter(&out, &textReporter{w: &out, cfg: newConfig(nil)}, "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a/1.txt", "b/1.txt", "b/2.txt"} {
+		if err := g.entry(&FileHeader{name: name, size: 1, csize: 1, class: classNormal, confidence: maxConfidence}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := g.summary(&Summary{Reason: reasonEOF}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"(1 entry, size 1, csize 1):", "(2 entries, size 2, csize 2):"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("no heading with %q in\n%s", want, out.String())
+		}
+	}
+}
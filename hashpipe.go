@@ -0,0 +1,120 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"io"
+	"sync"
+)
+
+// hashPipeline hashes the entries found in src with a fixed number of
+// workers before passing them on to rep in their original order. Entries
+// are streamed through the hash and at most twice as many as there are
+// workers wait to be reported, so memory use doesn't depend on the size of
+// the entries. src must be safe for concurrent use, which os.File and
+// bytes.Reader are.
+type hashPipeline struct {
+	rep reporter
+	src io.ReaderAt
+	// found is the reader the scan finds entries in, telling the entries
+	// of src apart from nested ones passing through.
+	found   io.ReaderAt
+	n       int
+	jobs    chan *hashJob
+	workers sync.WaitGroup
+	queue   []*hashJob
+	err     error
+}
+
+// hashJob is an entry waiting to be hashed, done is closed once it is.
+type hashJob struct {
+	h    *FileHeader
+	done chan struct{}
+}
+
+func newHashPipeline(rep reporter, src, found io.ReaderAt, n int) *hashPipeline {
+	p := &hashPipeline{rep: rep, src: src, found: found, n: n, jobs: make(chan *hashJob)}
+	p.workers.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer p.workers.Done()
+			for j := range p.jobs {
+				// Hashes are taken before decryption, as when
+				// hashing during the scan.
+				c := *j.h
+				c.password = ""
+				var err error
+				j.h.hash, err = entryHash(p.src, &c)
+				noteLimit(j.h, err)
+				close(j.done)
+			}
+		}()
+	}
+	return p
+}
+
+func (p *hashPipeline) entry(h *FileHeader) error {
+	if p.err != nil {
+		return p.err
+	}
+	c := *h
+	j := &hashJob{h: &c, done: make(chan struct{})}
+	if h.src == p.found {
+		p.jobs <- j
+	} else {
+		// Nested entries were hashed by the pipeline of their scan.
+		close(j.done)
+	}
+	p.queue = append(p.queue, j)
+	for len(p.queue) > 2*p.n {
+		if err := p.report(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// report passes on the oldest entry once it is hashed.
+func (p *hashPipeline) report() error {
+	j := p.queue[0]
+	<-j.done
+	p.queue[0] = nil
+	p.queue = p.queue[1:]
+	p.err = p.rep.entry(j.h)
+	return p.err
+}
+
+// flush reports the remaining entries.
+func (p *hashPipeline) flush() error {
+	for len(p.queue) > 0 && p.err == nil {
+		p.report()
+	}
+	return p.err
+}
+
+// close flushes the pipeline and stops the workers.
+func (p *hashPipeline) close() error {
+	err := p.flush()
+	close(p.jobs)
+	p.workers.Wait()
+	return err
+}
+
+func (p *hashPipeline) summary(s *Summary) error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+	return p.rep.summary(s)
+}
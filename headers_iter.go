@@ -0,0 +1,39 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build go1.23
+
+package main
+
+import (
+	"io"
+	"iter"
+)
+
+// Headers returns an iterator over the local file headers in the first size
+// bytes of r. Breaking out of the loop stops the scan. A scan error is
+// yielded last with an empty header.
+func Headers(r io.ReaderAt, size int64, opts ...Option) iter.Seq2[FileHeader, error] {
+	return func(yield func(FileHeader, error) bool) {
+		err := Walk(r, size, func(h FileHeader) error {
+			if !yield(h, nil) {
+				return SkipAll
+			}
+			return nil
+		}, opts...)
+		if err != nil {
+			yield(FileHeader{}, err)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// spillThreshold is how much of a non-seekable input is kept in memory
+// before it is spilled to a temporary file by default.
+const spillThreshold = 64 << 20
+
+// spill configures buffering of non-seekable input. The zero value keeps
+// up to spillThreshold bytes in memory and spills to the default
+// temporary directory.
+type spill struct {
+	maxMemory int64
+	dir       string
+}
+
+func (s spill) limit() int64 {
+	if s.maxMemory > 0 {
+		return s.maxMemory
+	}
+	return spillThreshold
+}
+
+// tempFiles tracks the spill files so they can be removed when the program
+// is interrupted.
+var tempFiles = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: make(map[string]bool)}
+
+// removeTempFiles removes all spill files that are still around.
+func removeTempFiles() {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	for name := range tempFiles.names {
+		os.Remove(name)
+		delete(tempFiles.names, name)
+	}
+}
+
+// readSeekerAt is what the scanner needs from its input: sequential reads
+// with seeking for the header search, random access for entry contents.
+type readSeekerAt interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+// ReaderAtFromSeeker returns an io.ReaderAt for rs and its size, found by
+// seeking to the end, for sources that can only seek. Reads seek to their
+// offset under a mutex, so the result is safe for concurrent use as long as
+// rs isn't used otherwise. A source that is an io.ReaderAt already is
+// returned as it is.
+func ReaderAtFromSeeker(rs io.ReadSeeker) (io.ReaderAt, int64, error) {
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, err
+	}
+	if r, ok := rs.(io.ReaderAt); ok {
+		return r, size, nil
+	}
+	return &seekerReaderAt{rs: rs}, size, nil
+}
+
+// seekerReaderAt implements io.ReaderAt by seeking.
+type seekerReaderAt struct {
+	mu sync.Mutex
+	rs io.ReadSeeker
+}
+
+func (s *seekerReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.rs.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(s.rs, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// openInput opens filename for scanning, with "-" meaning standard input.
+// Pipes and other inputs that can't seek are buffered first. The returned
+// function releases the input.
+func openInput(filename string, sp spill) (readSeekerAt, func(), error) {
+	f := os.Stdin
+	if filename != "-" {
+		var err error
+		f, err = os.Open(filename)
+		if err != nil {
+			return nil, nil, newOpenError(filename, err)
+		}
+		fi, err := f.Stat()
+		if err != nil || fi.IsDir() {
+			f.Close()
+			if err == nil {
+				err = errIsDir
+			}
+			return nil, nil, newOpenError(filename, err)
+		}
+		if fi.Mode()&os.ModeDevice != 0 && fi.Mode()&os.ModeCharDevice == 0 {
+			// Seeking to the end doesn't give the size of block devices
+			// everywhere, so ask the device.
+			if size, err := deviceSize(f); err == nil {
+				return io.NewSectionReader(f, 0, size), func() { f.Close() }, nil
+			}
+		}
+	}
+	if _, err := f.Seek(0, io.SeekCurrent); err == nil {
+		return f, func() { f.Close() }, nil
+	}
+	r, cleanup, err := bufferInput(f, sp)
+	f.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, cleanup, nil
+}
+
+// inflateInput decompresses f as a zlib or raw deflate stream into a
+// seekable buffer. ok is false if f is neither. If max is positive, the
+// stream may decompress to at most max bytes, or err tells it didn't fit.
+func inflateInput(f io.ReadSeeker, sp spill, max int64) (r readSeekerAt, format string, cleanup func(), ok bool, err error) {
+	formats := []struct {
+		name string
+		open func(io.Reader) (io.ReadCloser, error)
+	}{
+		{"zlib", zlib.NewReader},
+		{"deflate", func(r io.Reader) (io.ReadCloser, error) { return flate.NewReader(r), nil }},
+	}
+	for _, format := range formats {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, "", nil, false, nil
+		}
+		zr, err := format.open(bufio.NewReader(f))
+		if err != nil {
+			continue
+		}
+		if max > 0 {
+			zr = &budgetReader{rc: zr, b: &decompressionBudget{max: max}}
+		}
+		r, cleanup, err := bufferInput(zr, sp)
+		zr.Close()
+		if errors.Is(err, errDecompressionLimit) {
+			return nil, "", nil, false, err
+		}
+		if err != nil {
+			continue
+		}
+		if size, err := r.Seek(0, io.SeekEnd); err != nil || size == 0 {
+			cleanup()
+			continue
+		}
+		return r, format.name, cleanup, true, nil
+	}
+	return nil, "", nil, false, nil
+}
+
+var errIsDir = errors.New("is a directory")
+
+// openError is a failure to open an input file, with a category that
+// makes batch runs easy to diagnose.
+type openError struct {
+	filename string
+	category string
+	err      error
+}
+
+func newOpenError(filename string, err error) *openError {
+	category := "cannot open"
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		category = "not found"
+	case errors.Is(err, os.ErrPermission):
+		category = "permission denied"
+	case errors.Is(err, errIsDir):
+		category = "is a directory"
+	}
+	return &openError{filename, category, err}
+}
+
+func (e *openError) Error() string {
+	if e.err == errIsDir {
+		return e.filename + ": " + e.category + "; use -r to scan the files in it"
+	}
+	// The path is already part of the message.
+	err := e.err
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		err = pe.Err
+	}
+	return fmt.Sprintf("%s: %s (%v)", e.filename, e.category, err)
+}
+
+func (e *openError) Unwrap() error {
+	return e.err
+}
+
+// bufferInput reads r completely to make it seekable. Data is kept in memory
+// up to the limit of sp, larger inputs go to a temporary file which is
+// removed by the returned function. The spill file holds the data read so
+// far followed by the rest of r, and is checked to be exactly as long, so a
+// signature straddling the limit is found like any other: the search only
+// starts once the whole input is buffered.
+func bufferInput(r io.Reader, sp spill) (readSeekerAt, func(), error) {
+	limit := sp.limit()
+	buf, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(buf)) <= limit {
+		return bytes.NewReader(buf), func() {}, nil
+	}
+
+	tmp, err := os.CreateTemp(sp.dir, "hidden_zip-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	tempFiles.Lock()
+	tempFiles.names[tmp.Name()] = true
+	tempFiles.Unlock()
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		tempFiles.Lock()
+		delete(tempFiles.names, tmp.Name())
+		tempFiles.Unlock()
+	}
+	if _, err := tmp.Write(buf); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	size, err := tmp.Seek(0, io.SeekEnd)
+	if err == nil && size != int64(len(buf))+n {
+		err = fmt.Errorf("spill file %s has %d bytes, want %d", tmp.Name(), size, int64(len(buf))+n)
+	}
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return tmp, cleanup, nil
+}
+
+// readAhead serves sequential reads from an io.ReaderAt through a window of
+// data fetched in one go, which helps with sources where every ReadAt is
+// expensive. Seeking only moves the position.
+type readAhead struct {
+	r    io.ReaderAt
+	size int64
+	pos  int64
+	// win holds the data at winPos.
+	win    []byte
+	winPos int64
+	buf    []byte
+}
+
+func newReadAhead(r io.ReaderAt, size int64, window int) *readAhead {
+	return &readAhead{r: r, size: size, buf: make([]byte, window)}
+}
+
+func (ra *readAhead) Read(p []byte) (int, error) {
+	if ra.pos >= ra.size {
+		return 0, io.EOF
+	}
+	if ra.pos < ra.winPos || ra.pos >= ra.winPos+int64(len(ra.win)) {
+		buf := ra.buf
+		if left := ra.size - ra.pos; left < int64(len(buf)) {
+			buf = buf[:left]
+		}
+		n, err := ra.r.ReadAt(buf, ra.pos)
+		if n == 0 && err != nil {
+			return 0, err
+		}
+		ra.win, ra.winPos = buf[:n], ra.pos
+	}
+	n := copy(p, ra.win[ra.pos-ra.winPos:])
+	ra.pos += int64(n)
+	return n, nil
+}
+
+func (ra *readAhead) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += ra.pos
+	case io.SeekEnd:
+		offset += ra.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	ra.pos = offset
+	return offset, nil
+}
+
+// ReadAt reads like an io.SectionReader of the first size bytes, so data
+// past size is never returned.
+func (ra *readAhead) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off >= ra.size {
+		return 0, io.EOF
+	}
+	var err error
+	if left := ra.size - off; int64(len(p)) > left {
+		p, err = p[:left], io.EOF
+	}
+	if off >= ra.winPos && off+int64(len(p)) <= ra.winPos+int64(len(ra.win)) {
+		return copy(p, ra.win[off-ra.winPos:]), err
+	}
+	n, rerr := ra.r.ReadAt(p, off)
+	if rerr != nil {
+		err = rerr
+	}
+	return n, err
+}
+
+// byteSize is a flag value for sizes with an optional k, m or g suffix.
+type byteSize int64
+
+func (b *byteSize) String() string {
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(s string) error {
+	if s == "" {
+		return errors.New("empty size")
+	}
+	orig := s
+	mult := int64(1)
+	switch strings.ToLower(s[len(s)-1:]) {
+	case "k":
+		mult = 1 << 10
+	case "m":
+		mult = 1 << 20
+	case "g":
+		mult = 1 << 30
+	}
+	if mult != 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q", orig)
+	}
+	if n > math.MaxInt64/mult {
+		return fmt.Errorf("size %q is too large", orig)
+	}
+	*b = byteSize(n * mult)
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// TestBufferInputSpillBoundary places the first signature of an archive
+// around the point where buffering spills to a temporary file, so that it
+// ends up in memory, in the file or split between both.
+func TestBufferInputSpillBoundary(t *testing.T) {
+	const limit = 1024
+	archive := mustBuildFixture(t, []fixtureFile{{name: "a.txt", content: []byte("a"), method: zip.Store}})
+	for _, pos := range []int64{limit - 4, limit - 2, limit - 1, limit, limit + 1} {
+		input := append(make([]byte, pos), archive...)
+		sp := spill{maxMemory: limit, dir: t.TempDir()}
+		r, cleanup, err := bufferInput(iotest.HalfReader(bytes.NewReader(input)), sp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cleanup()
+		if _, ok := r.(*os.File); !ok {
+			t.Fatalf("signature at %d: input of %d bytes isn't spilled", pos, len(input))
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, input) {
+			t.Fatalf("signature at %d: buffered input differs", pos)
+		}
+		headers, err := ScanReaderAt(r, int64(len(input)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(headers) != 1 || headers[0].headerPos() != pos {
+			t.Errorf("signature at %d: found %d headers, want one at %d", pos, len(headers), pos)
+		}
+	}
+}
+
+func TestBufferInputInMemory(t *testing.T) {
+	input := []byte("PK\x03\x04")
+	r, cleanup, err := bufferInput(bytes.NewReader(input), spill{maxMemory: int64(len(input))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if _, ok := r.(*bytes.Reader); !ok {
+		t.Errorf("input as long as the limit is spilled")
+	}
+}
+
+// slowReaderAt is a source like a remote file over HTTP, where every ReadAt
+// costs a round trip.
+type slowReaderAt struct {
+	r       io.ReaderAt
+	latency time.Duration
+	reads   int64
+}
+
+func (s *slowReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	atomic.AddInt64(&s.reads, 1)
+	time.Sleep(s.latency)
+	return s.r.ReadAt(p, off)
+}
+
+// BenchmarkReadAhead scans a remote archive fetching 4 KiB at a time and
+// through the default read-ahead window.
+func BenchmarkReadAhead(b *testing.B) {
+	// Deflated content is searched for headers, unlike stored content.
+	content := make([]byte, 256<<10)
+	rand.New(rand.NewSource(1)).Read(content)
+	files := make([]fixtureFile, 8)
+	for i := range files {
+		files[i] = fixtureFile{name: fmt.Sprintf("%d.bin", i), content: content, method: zip.Deflate}
+	}
+	data := mustBuildFixture(b, files)
+	for _, bc := range []struct {
+		name   string
+		window int
+	}{{"4KiB", 4 << 10}, {"default", defaultReadAhead}} {
+		b.Run(bc.name, func(b *testing.B) {
+			src := &slowReaderAt{r: bytes.NewReader(data), latency: 100 * time.Microsecond}
+			for i := 0; i < b.N; i++ {
+				headers, err := ScanReaderAt(src, int64(len(data)), WithReadAhead(bc.window))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(headers) != len(files) {
+					b.Fatalf("found %d headers, want %d", len(headers), len(files))
+				}
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(&src.reads))/float64(b.N), "reads/op")
+		})
+	}
+}
+
+// TestReadAheadSize makes sure a read-ahead never returns data past its
+// size, even with a window reaching beyond it.
+func TestReadAheadSize(t *testing.T) {
+	data := []byte("0123456789")
+	ra := newReadAhead(bytes.NewReader(data), 6, 4)
+	b, err := io.ReadAll(ra)
+	if err != nil || string(b) != "012345" {
+		t.Errorf("Read gives %q, %v, want 012345", b, err)
+	}
+	for _, tc := range []struct {
+		off  int64
+		n    int
+		want string
+		err  error
+	}{
+		{0, 4, "0123", nil},
+		{4, 2, "45", nil},
+		{4, 4, "45", io.EOF},
+		{6, 2, "", io.EOF},
+		{8, 2, "", io.EOF},
+	} {
+		p := make([]byte, tc.n)
+		n, err := ra.ReadAt(p, tc.off)
+		if string(p[:n]) != tc.want || err != tc.err {
+			t.Errorf("ReadAt(%d bytes, %d) = %q, %v, want %q, %v", tc.n, tc.off, p[:n], err, tc.want, tc.err)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// flusher is implemented by buffered writers such as bufio.Writer.
+type flusher interface {
+	Flush() error
+}
+
+// openDocuments tracks the JSON documents that are still being written so
+// they can be closed when the program is interrupted. array is where the
+// documents of several inputs are wrapped in an array, if they are.
+var openDocuments = struct {
+	sync.Mutex
+	docs  map[*jsonDocument]bool
+	array io.Writer
+}{docs: make(map[*jsonDocument]bool)}
+
+// beginJSONArray starts the array that the documents of several inputs are
+// written to w in. The documents after the first are prefixed with a
+// comma.
+func beginJSONArray(w io.Writer) {
+	openDocuments.Lock()
+	defer openDocuments.Unlock()
+	openDocuments.array = w
+	io.WriteString(w, "[\n")
+}
+
+// endJSONArray ends the array started by beginJSONArray, if any.
+func endJSONArray() {
+	openDocuments.Lock()
+	defer openDocuments.Unlock()
+	if openDocuments.array != nil {
+		io.WriteString(openDocuments.array, "]\n")
+		openDocuments.array = nil
+	}
+}
+
+// closeDocuments ends all open JSON documents, leaving valid JSON behind.
+func closeDocuments() {
+	// Documents take the lock while holding their own, so collect them
+	// first.
+	openDocuments.Lock()
+	var docs []*jsonDocument
+	for d := range openDocuments.docs {
+		docs = append(docs, d)
+	}
+	openDocuments.Unlock()
+	for _, d := range docs {
+		d.interrupt()
+	}
+	endJSONArray()
+}
+
+// jsonDocument writes a single indented {"entries": [...], "summary": ...}
+// document. Entries are written as they are found, with the writer flushed
+// after each, so a live consumer doesn't wait for the end of a long scan.
+// An interrupted scan ends the document with "interrupted": true instead
+// of the summary. If file is set, the document names the scanned file.
+// prefix is written before the document, to separate it from the one
+// before.
+type jsonDocument struct {
+	w      io.Writer
+	file   string
+	prefix string
+
+	// mu keeps an interrupt from closing the document in the middle of
+	// an entry.
+	mu      sync.Mutex
+	started bool
+	done    bool
+	entries int
+}
+
+func (d *jsonDocument) entry(h *FileHeader) error {
+	e := newJSONEntry(h)
+	e.File = d.file
+	b, err := json.MarshalIndent(e, "    ", "  ")
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.done {
+		return nil
+	}
+	if err := d.start(); err != nil {
+		return err
+	}
+	sep := ",\n    "
+	if d.entries == 0 {
+		sep = "\n    "
+	}
+	d.entries++
+	return d.write(sep + string(b))
+}
+
+func (d *jsonDocument) summary(s *Summary) error {
+	b, err := json.MarshalIndent(s, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.done {
+		return nil
+	}
+	if err := d.start(); err != nil {
+		return err
+	}
+	d.finish()
+	return d.write(d.closeEntries() + ",\n  \"summary\": " + string(b) + "\n}\n")
+}
+
+// start writes the beginning of the document up to the entries array.
+func (d *jsonDocument) start() error {
+	if d.started {
+		return nil
+	}
+	d.started = true
+	openDocuments.Lock()
+	openDocuments.docs[d] = true
+	openDocuments.Unlock()
+	head := d.prefix + "{\n"
+	if d.file != "" {
+		name, err := json.Marshal(d.file)
+		if err != nil {
+			return err
+		}
+		head += "  \"file\": " + string(name) + ",\n"
+	}
+	return d.write(head + "  \"entries\": [")
+}
+
+// closeEntries returns the end of the entries array.
+func (d *jsonDocument) closeEntries() string {
+	if d.entries == 0 {
+		return "]"
+	}
+	return "\n  ]"
+}
+
+// finish marks the document done. The caller holds d.mu.
+func (d *jsonDocument) finish() {
+	d.done = true
+	openDocuments.Lock()
+	delete(openDocuments.docs, d)
+	openDocuments.Unlock()
+}
+
+// interrupt ends a document that has been started but not finished.
+func (d *jsonDocument) interrupt() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.started || d.done {
+		return
+	}
+	d.finish()
+	d.write(d.closeEntries() + ",\n  \"interrupted\": true\n}\n")
+}
+
+// write writes s and flushes buffered writers.
+func (d *jsonDocument) write(s string) error {
+	if _, err := io.WriteString(d.w, s); err != nil {
+		return err
+	}
+	if f, ok := d.w.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import "sort"
+
+// span is the byte range [start, end) of a structure in the file.
+type span struct {
+	start, end int64
+}
+
+// region is a span taken up by a kind of structure.
+type region struct {
+	span
+	kind byte
+}
+
+// Region kinds, which are also the characters -map draws them with.
+// Gaps are unaccounted bytes, trailing ones follow the end of central
+// directory record.
+const (
+	regionHeader   = 'h'
+	regionData     = '='
+	regionCentral  = 'C'
+	regionEOCD     = 'E'
+	regionSigning  = 'S'
+	regionGap      = '.'
+	regionTrailing = 't'
+)
+
+// spansOf returns the spans of regions.
+func spansOf(regions []region) []span {
+	spans := make([]span, len(regions))
+	for i, r := range regions {
+		spans[i] = r.span
+	}
+	return spans
+}
+
+// clampRegions cuts regions to the size bytes of the file, as bogus sizes
+// may claim more. overrun is the number of bytes cut off past the end.
+func clampRegions(regions []region, size int64) (clamped []region, overrun int64) {
+	var past []span
+	for _, r := range regions {
+		if r.end > size {
+			start := r.start
+			if start < size {
+				start = size
+			}
+			past = append(past, span{start, r.end})
+			r.end = size
+		}
+		if r.start < 0 {
+			r.start = 0
+		}
+		if r.start < r.end {
+			clamped = append(clamped, r)
+		}
+	}
+	return clamped, coverage(past)
+}
+
+// mergeSpans sorts spans and merges overlapping and adjacent ones.
+func mergeSpans(spans []span) []span {
+	sorted := append([]span(nil), spans...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].start < sorted[j].start })
+	var merged []span
+	for _, sp := range sorted {
+		if n := len(merged); n > 0 && sp.start <= merged[n-1].end {
+			if sp.end > merged[n-1].end {
+				merged[n-1].end = sp.end
+			}
+			continue
+		}
+		merged = append(merged, sp)
+	}
+	return merged
+}
+
+// coverage returns the number of bytes covered by spans.
+func coverage(spans []span) int64 {
+	var n int64
+	for _, sp := range mergeSpans(spans) {
+		n += sp.end - sp.start
+	}
+	return n
+}
+
+// gaps returns the ranges of the size bytes of the file not covered by
+// spans.
+func gaps(spans []span, size int64) []span {
+	var gs []span
+	pos := int64(0)
+	for _, sp := range mergeSpans(spans) {
+		if sp.start > pos {
+			gs = append(gs, span{pos, sp.start})
+		}
+		if sp.end > pos {
+			pos = sp.end
+		}
+	}
+	if pos < size {
+		gs = append(gs, span{pos, size})
+	}
+	return gs
+}
@@ -17,87 +17,272 @@ package main
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
-	"os"
+	"strings"
+	"sync"
+	"time"
 )
 
-const fileHeaderSignature = 0x04034b50
+const (
+	fileHeaderSignature     = 0x04034b50
+	dataDescriptorSignature = 0x08074b50
+)
+
+// fileHeaderSep is fileHeaderSignature as it appears in the file.
+var fileHeaderSep = []byte{0x50, 0x4b, 0x03, 0x04}
+
+// defaultReadAhead is the window through which inputs are read. Most
+// seeking between headers stays within the window and costs no syscall.
+const defaultReadAhead = 64 << 10
+
+// scanWindow is how much scanReader reads at a time.
+const scanWindow = 4096
+
+// headerBufs holds the buffers nextFileHeader scans through. Besides the
+// window, they have room to complete a header found at its very end.
+var headerBufs = sync.Pool{
+	New: func() any {
+		buf := make([]byte, scanWindow+localHeaderMax)
+		return &buf
+	},
+}
 
-// scanReader reads from r until it finds sep, returning a slice of read data after sep.
-func scanReader(r io.Reader, sep []byte) ([]byte, error) {
+// scanReader reads from r into buf until it finds sep, returning a slice of
+// read data after sep. The slice shares buf, including its capacity.
+func scanReader(r io.Reader, sep []byte, buf []byte) ([]byte, error) {
 	start := 0
-	buf := make([]byte, 4096)
 	for {
 		n, err := r.Read(buf[start:])
 		if err != nil {
 			return nil, err
 		}
 		n += start
+		// bytes.Index already skips ahead to the first byte of sep
+		// with IndexByte. Doing so by hand and verifying the rest is
+		// slower, see BenchmarkScanReader.
 		if idx := bytes.Index(buf[:n], sep); idx != -1 {
-			//fmt.Printf("idx=%d, n=%d len(sep)=%d\n", idx, n, len(sep))
 			return buf[idx+len(sep) : n], nil
 		}
-		// Make sure we don't miss s at the read boundary.
+		// Make sure we don't miss s at the read boundary. Short reads may
+		// have left fewer bytes than that.
 		start = len(sep) - 1
-		copy(buf[:start], buf[n-start:])
+		if n < start {
+			start = n
+		}
+		copy(buf[:start], buf[n-start:n])
 	}
 }
 
-type FileHeader = struct {
+type FileHeader struct {
 	version, flags, compression, mtime, mdate, namelen, extralen uint16
 	crc32, csize, size                                           uint32
 	name                                                         string
 	extra                                                        []byte
+
+	// pos is the position of the entry data in the file.
+	pos int64
+	// warnings collects anomalies found while checking the entry.
+	warnings []string
+	// central is the central directory record of the entry, if any.
+	central *centralRecord
+	// hash is the hex encoded SHA-256 of the content, if computed.
+	hash string
+	// hidden is set if archive/zip doesn't list the entry.
+	hidden bool
+	// src is the file the entry was found in.
+	src io.ReaderAt
+	// containers names what a nested scan found the entry in, outermost
+	// first: entries for -scan-entry, members of tar files and CFB streams.
+	containers []string
+	// sizeSource tells where crc32, csize and size come from, as these
+	// may be missing from the local header.
+	sizeSource string
+	// modTime is the modification time from the most precise source,
+	// which modTimeSource names.
+	modTime       time.Time
+	modTimeSource string
+	// owner is the Unix ownership from the extra field, if any.
+	owner *owner
+	// innerSignatures counts the zip signatures within the entry data.
+	innerSignatures int
+	// class is normal, hidden or phantom, with phantomReasons explaining
+	// the latter.
+	class          string
+	phantomReasons []string
+	// confidence scores from 0 to 100 how likely the entry is real.
+	confidence int
+	// entropy is the Shannon entropy of the content in bits per byte, if
+	// computed.
+	entropy *float64
+	// explanation lists the signals behind class and confidence, for
+	// -explain.
+	explanation []string
+	// budget limits decompressing the entry, if set. charged is how much
+	// of the content has counted against it so far.
+	budget  *decompressionBudget
+	charged int64
+	// password decrypts the entry, decryption tells whether it fits.
+	password   string
+	decryption string
+	// integrity is the verdict of -validate, empty if unchecked.
+	integrity string
 }
 
-func nextFileHeader(r io.ReadSeeker) (*FileHeader, error) {
-	sep := new(bytes.Buffer)
-	err := binary.Write(sep, binary.LittleEndian, uint32(fileHeaderSignature))
-	if err != nil {
-		fmt.Println("binary.Write failed:", err)
-		return nil, err
+// ModTime returns the modification time from the MS-DOS date and time
+// fields. These have no time zone, so the result is in UTC.
+func (h *FileHeader) ModTime() time.Time {
+	return msDosTime(h.mdate, h.mtime, time.UTC)
+}
+
+// IsDir reports whether the entry is a directory marker: an empty entry
+// whose name ends in a slash.
+func (h *FileHeader) IsDir() bool {
+	return strings.HasSuffix(h.name, "/") && h.size == 0
+}
+
+// msDosTime decodes an MS-DOS date and time as wall clock time in loc.
+func msDosTime(date, t uint16, loc *time.Location) time.Time {
+	return time.Date(
+		int(date>>9)+1980, time.Month(date>>5&0xf), int(date&0x1f),
+		int(t>>11), int(t>>5&0x3f), int(t&0x1f)*2, 0, loc)
+}
+
+// Where the modification time of an entry comes from.
+const (
+	timeDOS      = "dos"
+	timeExtended = "extended"
+	timeUnix     = "unix"
+)
+
+// setModTime picks the best modification time of h: an extended timestamp
+// or, lacking one, the old Info-ZIP Unix field is an actual point in time,
+// the MS-DOS time is interpreted in loc.
+func setModTime(h *FileHeader, loc *time.Location) {
+	if t, ok := extendedModTime(h.extra); ok {
+		h.modTime, h.modTimeSource = t.In(loc), timeExtended
+		return
+	}
+	if t, _, ok := infoZIPUnix(h.extra); ok {
+		h.modTime, h.modTimeSource = t.In(loc), timeUnix
+		return
 	}
+	if h.central != nil {
+		if t, _, ok := infoZIPUnix(h.central.extra); ok {
+			h.modTime, h.modTimeSource = t.In(loc), timeUnix
+			return
+		}
+	}
+	h.modTime, h.modTimeSource = msDosTime(h.mdate, h.mtime, loc), timeDOS
+}
+
+// headerPos returns the position of the local file header signature.
+func (h *FileHeader) headerPos() int64 {
+	return h.pos - 30 - int64(h.namelen) - int64(h.extralen)
+}
+
+// localHeaderFields is the fixed part of a local file header following the
+// signature.
+type localHeaderFields struct {
+	Version, Flags, Compression, Mtime, Mdate uint16
+	CRC32, Csize, Size                        uint32
+	Namelen, Extralen                         uint16
+}
+
+// localHeaderMax is how much of a local file header nextFileHeader reads
+// after the signature, assuming a file and extra length of at most 255.
+const localHeaderMax = 30 + 255
+
+// rejectFunc is told about signature matches at pos that aren't taken as
+// headers, with the bytes of the candidate header and the reason.
+type rejectFunc func(pos int64, raw []byte, reason string)
+
+// nextFileHeader searches r for the next local file header. A header whose
+// extra field runs past the end of the file is returned with the extra
+// bytes that exist and a warning, unless strict is set. Rejected matches
+// are passed to reject if it isn't nil.
+func nextFileHeader(r io.ReadSeeker, strict bool, reject rejectFunc) (*FileHeader, error) {
+	// The buffer goes back to the pool on return, so nothing may keep
+	// pointing into it. Only what was read by this call is looked at, which
+	// makes leftovers of earlier uses harmless.
+	bufp := headerBufs.Get().(*[]byte)
+	defer headerBufs.Put(bufp)
+	window := (*bufp)[:scanWindow]
+
+	// retry is the position where the search resumed after the last
+	// rejected match.
+	retry := int64(-1)
 	for {
-		rest, err := scanReader(r, sep.Bytes())
+		rest, err := scanReader(r, fileHeaderSep, window)
 		if err != nil {
 			return nil, err
 		}
-		// assume maximum file and extra length of 255
-		headersize := 30 + 255
-		if len(rest) < headersize {
-			rest = append(rest, make([]byte, headersize)...)
-			n, err := r.Read(rest[len(rest)-headersize:])
+		if len(rest) < localHeaderMax {
+			// Reads may be short, so keep reading until the header is
+			// complete or the file ends. The buffer has room for it past
+			// the window.
+			n := len(rest)
+			rest = rest[:localHeaderMax]
+			m, err := io.ReadFull(r, rest[n:])
+			if err == io.EOF && n > 0 || err == io.ErrUnexpectedEOF {
+				err = nil
+			}
 			if err != nil {
 				return nil, err
 			}
-			rest = rest[len(rest)-headersize : len(rest)-headersize+n]
-		}
-		buf := bytes.NewBuffer(rest)
-		var h FileHeader
-		binary.Read(buf, binary.LittleEndian, &h.version)
-		binary.Read(buf, binary.LittleEndian, &h.flags)
-		binary.Read(buf, binary.LittleEndian, &h.compression)
-		binary.Read(buf, binary.LittleEndian, &h.mtime)
-		binary.Read(buf, binary.LittleEndian, &h.mdate)
-		binary.Read(buf, binary.LittleEndian, &h.crc32)
-		binary.Read(buf, binary.LittleEndian, &h.csize)
-		binary.Read(buf, binary.LittleEndian, &h.size)
-		binary.Read(buf, binary.LittleEndian, &h.namelen)
-		binary.Read(buf, binary.LittleEndian, &h.extralen)
+			rest = rest[:n+m]
+		}
+		if len(rest) < 26 {
+			// There's no room for a complete header before the end.
+			return nil, io.EOF
+		}
+		var fields localHeaderFields
+		if err := binary.Read(bytes.NewReader(rest[:26]), binary.LittleEndian, &fields); err != nil {
+			return nil, fmt.Errorf("reading local file header: %w", err)
+		}
+		h := FileHeader{
+			version: fields.Version, flags: fields.Flags, compression: fields.Compression,
+			mtime: fields.Mtime, mdate: fields.Mdate,
+			crc32: fields.CRC32, csize: fields.Csize, size: fields.Size,
+			namelen: fields.Namelen, extralen: fields.Extralen,
+		}
 		//fmt.Printf("version=%d flags=%x compression=%d mtime=%d mdate=%d crc32=%x csize=%d size=%d namelen=%d extralen=%d\n",
 		//h.version, h.flags, h.compression, h.mtime, h.mdate, h.crc32, h.csize, h.size, h.namelen, h.extralen)
 
-		if h.namelen > 255 || h.extralen > 255 || h.namelen+h.extralen > 255 {
-			_, err = r.Seek(-int64(len(rest)), io.SeekCurrent)
+		var truncated string
+		if n := 26 + int(h.namelen) + int(h.extralen); !strict && n > len(rest) && 26+int(h.namelen) <= len(rest) {
+			// The file ends within the extra field.
+			truncated = fmt.Sprintf("extra field truncated: %d of %d bytes", len(rest)-26-int(h.namelen), h.extralen)
+			h.extralen = uint16(len(rest) - 26 - int(h.namelen))
+		}
+		if reason := rejectReason(&h, len(rest)); reason != "" {
+			// Resume right after the signature. Make sure this always
+			// moves forward so a bad match can't be found over and over.
+			next, err := r.Seek(-int64(len(rest)), io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+			if reject != nil {
+				reject(next-4, append(append([]byte(nil), fileHeaderSep...), rest[:26]...), reason)
+			}
+			if next <= retry {
+				if next, err = r.Seek(retry+1, io.SeekStart); err != nil {
+					return nil, err
+				}
+			}
+			retry = next
 			continue
 		}
 		h.name = string(rest[26 : 26+h.namelen])
 		h.extra = append(h.extra, rest[26+h.namelen:26+h.namelen+h.extralen]...)
+		if truncated != "" {
+			h.warnings = append(h.warnings, truncated)
+		}
 
 		// Don't skip over file contents to find nested zip entries.
 		//_, err = r.Seek(-int64(len(rest))+26+int64(h.namelen)+int64(h.extralen)+int64(h.size), io.SeekCurrent)
-		_, err = r.Seek(-int64(len(rest))+26+int64(h.namelen)+int64(h.extralen), io.SeekCurrent)
+		h.pos, err = r.Seek(-int64(len(rest))+26+int64(h.namelen)+int64(h.extralen), io.SeekCurrent)
 		if err != nil {
 			return nil, err
 		}
@@ -106,34 +291,596 @@ func nextFileHeader(r io.ReadSeeker) (*FileHeader, error) {
 	}
 }
 
-func searchFileHeaders(filename string) error {
-	f, err := os.Open(filename)
+// rejectReason explains why h doesn't fit into the n bytes following the
+// signature, or returns "" if it does.
+func rejectReason(h *FileHeader, n int) string {
+	switch {
+	case h.namelen > 255:
+		return fmt.Sprintf("namelen=%d exceeds 255", h.namelen)
+	case h.extralen > 255:
+		return fmt.Sprintf("extralen=%d exceeds 255", h.extralen)
+	case h.namelen+h.extralen > 255:
+		return fmt.Sprintf("namelen+extralen=%d exceeds 255", h.namelen+h.extralen)
+	case 26+int(h.namelen)+int(h.extralen) > n:
+		return fmt.Sprintf("namelen=%d extralen=%d run past the end of the file", h.namelen, h.extralen)
+	}
+	return ""
+}
+
+// config holds the settings for a scan, filled from the command line.
+type config struct {
+	// hash enables hashing the content of every entry.
+	hash bool
+	// hashJobs is the number of entries hashed at the same time.
+	hashJobs int
+	// maxDecompressed limits how much any entry and all entries of an
+	// input together decompress to. budget tracks it for an input.
+	maxDecompressed int64
+	budget          *decompressionBudget
+	// ignoreHashes lists SHA-256 hashes of entry contents to suppress.
+	ignoreHashes map[string]bool
+	// scanEntry names an entry whose content is searched for nested headers.
+	scanEntry string
+	// scanStored disables skipping over the content of stored entries.
+	scanStored bool
+	// readAhead is the size of the read-ahead window, if any.
+	readAhead int
+	// tarMembers enables scanning tar inputs member by member.
+	tarMembers bool
+	// oleStreams enables scanning the streams of OLE compound files one by
+	// one.
+	oleStreams bool
+	// showComment includes the archive comment in the summary.
+	showComment bool
+	// hiddenOnly limits the output to hidden entries.
+	hiddenOnly bool
+	// explain records why entries got their class and confidence.
+	explain bool
+	// noDirs leaves out directory entries.
+	noDirs bool
+	// only limits the output to the entries of an -only category.
+	only func(*FileHeader) bool
+	// stopAtEOCD ends the scan with the first archive in the file.
+	stopAtEOCD bool
+	// Entries modified more than maxFuture after the scan started or
+	// before minYear are flagged.
+	maxFuture time.Duration
+	minYear   int
+	now       time.Time
+	// validate enables checks that decompress the content of entries.
+	validate bool
+	// start is the offset the search for headers starts at. checkpoint
+	// records how far the search got.
+	start      int64
+	checkpoint *checkpoint
+	// inflateFirst scans the zlib or deflate decompressed input if it is
+	// compressed.
+	inflateFirst bool
+	// spill configures buffering of input that can't seek.
+	spill spill
+	// password decrypts encrypted entries.
+	password string
+	// minEntries is the number of chained entries an input needs to count
+	// as an archive.
+	minEntries int
+	// entropy computes the entropy of every entry, flagging those above
+	// entropyThreshold.
+	entropy          bool
+	entropyThreshold float64
+	// bounds are the plausible sizes of entries.
+	bounds sizeBounds
+	// minConfidence leaves out entries with a lower confidence.
+	minConfidence int
+	// follow keeps scanning data appended to the file until it hasn't
+	// grown for this long.
+	follow time.Duration
+	// showRejects reports signature matches that aren't taken as headers.
+	showRejects bool
+	// strict rejects headers that don't fit into the file.
+	strict bool
+	// centralOnly takes the entries from the central directory instead of
+	// searching the content for headers.
+	centralOnly bool
+	// skip is the size of a known stub before the archive that isn't
+	// searched.
+	skip int64
+	// loc is the time zone MS-DOS times are interpreted in.
+	loc *time.Location
+}
+
+// Defaults for the timestamp checks.
+const (
+	defaultMaxFuture = 24 * time.Hour
+	defaultMinYear   = 1980
+)
+
+// Option configures a scan started with ScanReaderAt.
+type Option func(*config)
+
+// WithScanStored searches the content of stored entries for headers as well.
+func WithScanStored() Option {
+	return func(c *config) { c.scanStored = true }
+}
+
+// WithReadAhead reads the source in chunks of n bytes, for sources where
+// small reads are slow.
+func WithReadAhead(n int) Option {
+	return func(c *config) { c.readAhead = n }
+}
+
+// WithHiddenOnly only returns entries that archive/zip doesn't list.
+func WithHiddenOnly() Option {
+	return func(c *config) { c.hiddenOnly = true }
+}
+
+// newConfig returns the library defaults with opts applied.
+func newConfig(opts []Option) *config {
+	cfg := &config{maxFuture: defaultMaxFuture, minYear: defaultMinYear, now: time.Now(), loc: time.Local}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// reports tells whether h passes the output filters. Filtered entries still
+// count in the summary.
+func (c *config) reports(h *FileHeader) bool {
+	return (!c.hiddenOnly || h.hidden) && (!c.noDirs || !h.IsDir()) && h.confidence >= c.minConfidence && (c.only == nil || c.only(h))
+}
+
+// withBudget returns c with a fresh decompression budget for an input, if
+// decompression is limited.
+func (c *config) withBudget() *config {
+	if c.maxDecompressed <= 0 {
+		return c
+	}
+	b := *c
+	b.budget = &decompressionBudget{max: c.maxDecompressed}
+	return &b
+}
+
+// window returns the read-ahead window size for library scans.
+func (c *config) window() int {
+	if c.readAhead > 0 {
+		return c.readAhead
+	}
+	return defaultReadAhead
+}
+
+// WithUTC interprets MS-DOS times as UTC instead of local time.
+func WithUTC() Option {
+	return func(c *config) { c.loc = time.UTC }
+}
+
+// WithValidate enables checks that decompress the content of entries.
+func WithValidate() Option {
+	return func(c *config) { c.validate = true }
+}
+
+// WithHash computes the SHA-256 of the content of every entry.
+func WithHash() Option {
+	return func(c *config) { c.hash = true }
+}
+
+// WithHashJobs hashes up to n entries at the same time. r must then be safe
+// for concurrent use.
+func WithHashJobs(n int) Option {
+	return func(c *config) { c.hashJobs = n }
+}
+
+// WithIgnoreHashes suppresses entries whose content has one of the given
+// hex encoded SHA-256 hashes.
+func WithIgnoreHashes(hashes map[string]bool) Option {
+	return func(c *config) { c.ignoreHashes = hashes }
+}
+
+// WithScanEntry searches the content of the named entry for nested headers.
+func WithScanEntry(name string) Option {
+	return func(c *config) { c.scanEntry = name }
+}
+
+// ScanReaderAt searches the first size bytes of r for local file headers.
+func ScanReaderAt(r io.ReaderAt, size int64, opts ...Option) ([]FileHeader, error) {
+	var headers []FileHeader
+	err := Walk(r, size, func(h FileHeader) error {
+		headers = append(headers, h)
+		return nil
+	}, opts...)
+	return headers, err
+}
+
+// SkipAll can be returned by a Walk callback to stop the scan without an
+// error.
+var SkipAll = errors.New("skip remaining headers")
+
+// Walk searches the first size bytes of r for local file headers, calling
+// fn for each header as it is found. An error returned by fn stops the scan
+// and is returned by Walk, except for SkipAll.
+func Walk(r io.ReaderAt, size int64, fn func(FileHeader) error, opts ...Option) error {
+	cfg := newConfig(opts)
+	var s Summary
+	// The section keeps everything, including archive/zip, within size.
+	r = io.NewSectionReader(r, 0, size)
+	err := scanFileHeaders(newReadAhead(r, size, cfg.window()), cfg, walkReporter(fn), &s)
+	if err == SkipAll {
+		err = nil
+	}
+	return err
+}
+
+func searchFileHeaders(filename string, cfg *config, rep reporter) error {
+	var s Summary
+	cfg = cfg.withBudget()
+	err := func() error {
+		f, release, err := openInput(filename, cfg.spill)
+		if err != nil {
+			return err
+		}
+		defer release()
+		if cfg.follow > 0 {
+			return followFileHeaders(filename, cfg, rep, &s, cfg.follow)
+		}
+		if cfg.inflateFirst {
+			inflated, format, cleanup, ok, err := inflateInput(f, cfg.spill, cfg.maxDecompressed)
+			if err != nil {
+				s.Warnings = append(s.Warnings, fmt.Sprintf("inflating input: %v", err))
+			}
+			if ok {
+				defer cleanup()
+				f, s.Inflated = inflated, format
+			}
+		}
+		if cfg.readAhead > 0 {
+			size, err := f.Seek(0, io.SeekEnd)
+			if err != nil {
+				return err
+			}
+			f = newReadAhead(f, size, cfg.readAhead)
+		}
+		if cfg.tarMembers && isTar(f) {
+			return scanTarMembers(f, filename, cfg, rep, &s)
+		}
+		if cfg.oleStreams && isCFB(f) {
+			return scanCFBStreams(f, filename, cfg, rep, &s)
+		}
+		return scanFileHeaders(f, cfg, rep, &s)
+	}()
+	if err == nil && s.foundZip() && s.Chained < cfg.minEntries {
+		err = fmt.Errorf("%s: %w", filename, &incoherentError{s.Entries})
+	}
+	switch {
+	case err != nil:
+		s.Reason, s.Error = reasonError, err.Error()
+	case !s.foundZip():
+		s.Reason = reasonNotZip
+	default:
+		s.Reason = reasonEOF
+	}
+	if serr := rep.summary(&s); err == nil {
+		err = serr
+	}
+	return err
+}
+
+func scanFileHeaders(f readSeekerAt, cfg *config, rep reporter, s *Summary) (err error) {
+	size, err := f.Seek(0, io.SeekEnd)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	// The hash workers read concurrently from the source rather than
+	// through the read-ahead window.
+	src := io.ReaderAt(f)
+	if ra, ok := f.(*readAhead); ok {
+		src = ra.r
+	}
+	if cfg.stopAtEOCD {
+		if end, ok := firstArchiveEnd(f, size); ok {
+			f, size = io.NewSectionReader(f, 0, end), end
+		}
+	}
+	if _, ok := f.(*readAhead); !ok {
+		f = newReadAhead(f, size, defaultReadAhead)
+	}
+	hashJobs := 0
+	if cfg.hash && cfg.ignoreHashes == nil && cfg.hashJobs > 1 {
+		// Suppressing entries by hash needs the hash right away.
+		hashJobs = cfg.hashJobs
+		p := newHashPipeline(rep, src, f, hashJobs)
+		defer func() {
+			if perr := p.close(); err == nil {
+				err = perr
+			}
+		}()
+		rep = p
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	// Not every input is a complete archive, so the central directory is
+	// optional.
+	cd, _ := readCentralDirectory(f, size)
+	s.Size = size
+	var regions []region
+	if cd != nil {
+		regions = append(regions,
+			region{span{cd.pos, cd.pos + cd.size}, regionCentral},
+			region{span{cd.eocdPos, cd.eocdPos + 22 + int64(len(cd.comment))}, regionEOCD})
+		eocd := cd.eocdPos
+		s.EOCD = &eocd
+		s.Trailing = size - (cd.eocdPos + 22 + int64(len(cd.comment)))
+		s.CommentLength = len(cd.comment)
+		s.Warnings = append(s.Warnings, checkComment(cd.comment)...)
+		s.Warnings = append(s.Warnings, checkCentralOrder(cd)...)
+		b, warnings := readSigningBlock(f, cd.pos)
+		if b != nil {
+			s.SigningBlock = b
+			regions = append(regions, region{span{b.Offset, b.Offset + b.Size}, regionSigning})
+		}
+		s.Warnings = append(s.Warnings, warnings...)
+		if cfg.showComment {
+			s.Comment = string(cd.comment)
+		}
+	}
+	// Without archive/zip's view, no entry can be told hidden. This is
+	// only worth a warning once an entry turns up.
+	visible, verr := visibleDataOffsets(f, size)
+	warnVisibility := verr != nil
+	start := cfg.start
+	if cfg.skip > 0 {
+		s.Skipped = cfg.skip
+		if cfg.skip > start {
+			start = cfg.skip
+		}
+	}
+	if start > 0 {
+		if cfg.start > 0 {
+			s.Start = start
+		}
+		if _, err := f.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+	}
 
+	var first []*FileHeader
+	var data []entryData
+	periodic := &periodicFilter{rep: rep}
+	// last is the header position of the previous entry. Headers must be
+	// found in increasing order, anything else would loop.
+	last := int64(-1)
+	var reject rejectFunc
+	if cfg.showRejects {
+		reject = func(pos int64, raw []byte, reason string) {
+			s.Rejected = append(s.Rejected, Rejection{pos, fmt.Sprintf("% x", raw), reason})
+		}
+	}
+	next := func() (*FileHeader, error) { return nextFileHeader(f, cfg.strict, reject) }
+	// progress records that the scan is done with everything before the
+	// current position.
+	progress := func() error {
+		if cfg.checkpoint == nil {
+			return nil
+		}
+		pos, err := f.Seek(0, io.SeekCurrent)
+		if err == nil {
+			err = cfg.checkpoint.record(pos, false)
+		}
+		if err != nil {
+			return fmt.Errorf("checkpoint: %w", err)
+		}
+		return nil
+	}
+	if cfg.centralOnly {
+		if cd == nil {
+			return errors.New("no central directory to list")
+		}
+		next = cd.localHeaders(f)
+	}
 	for {
-		header, err := nextFileHeader(f)
+		header, err := next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
 			return err
 		}
-		pos, err := f.Seek(0, io.SeekCurrent)
+		if !cfg.centralOnly && header.headerPos() <= last {
+			return fmt.Errorf("no forward progress: header at %d found after header at %d", header.headerPos(), last)
+		}
+		last = header.headerPos()
+		s.resume = header.pos
+		header.src = f
+		header.budget = cfg.budget
+		header.central = cd.lookup(header.headerPos())
+		recoverSizes(f, header, size)
+		if cfg.strict {
+			// The file size alone rules out these matches.
+			if reasons := sizeReasons(header, size, cfg.bounds); reasons != nil {
+				if reject != nil {
+					raw := make([]byte, 30)
+					f.ReadAt(raw, header.headerPos())
+					reject(header.headerPos(), raw, strings.Join(reasons, ", "))
+				}
+				continue
+			}
+		}
+		setModTime(header, cfg.loc)
+		header.innerSignatures = countSignatures(f, header, size)
+		header.owner, _ = unixOwner(header.extra)
+		if header.owner == nil && header.central != nil {
+			header.owner, _ = unixOwner(header.central.extra)
+		}
+		if header.owner == nil {
+			_, header.owner, _ = infoZIPUnix(header.extra)
+		}
+		end := header.pos + int64(header.csize)
+		regions = append(regions,
+			region{span{header.headerPos(), header.pos}, regionHeader},
+			region{span{header.pos, end}, regionData},
+			region{span{end, end + descriptorLen(f, header)}, regionHeader})
+		data = append(data, entryData{header.name, span{header.pos, header.pos + int64(header.csize)}})
+		if s.FirstHeader == nil {
+			first := header.headerPos()
+			s.FirstHeader, s.Prefix = &first, first
+		}
+		if !cfg.scanStored && isChainedStored(f, header, size) {
+			// Stored content is arbitrary data that may contain the
+			// signature, so skip over it.
+			if _, err := f.Seek(header.pos+int64(header.csize), io.SeekStart); err != nil {
+				return err
+			}
+		}
+		if hashJobs == 0 && (cfg.hash || cfg.ignoreHashes != nil) {
+			// Entries that can't be decompressed just don't get a hash.
+			var herr error
+			header.hash, herr = entryHash(f, header)
+			noteLimit(header, herr)
+		}
+		if header.hash != "" && cfg.ignoreHashes[header.hash] {
+			s.Suppressed++
+			if err := progress(); err != nil {
+				return err
+			}
+			continue
+		}
+		if cfg.password != "" {
+			header.password = cfg.password
+			checkPassword(f, header)
+		}
+		checkMagic(f, header)
+		checkMethod(header)
+		checkCentral(header)
+		checkVersions(header)
+		checkExtra(header)
+		checkName(header)
+		if cfg.validate {
+			checkContent(f, header, size)
+		}
+		if cfg.entropy {
+			checkEntropy(f, header, cfg.entropyThreshold)
+		}
+		checkModTime(header, cfg)
+		header.hidden = verr == nil && !visible[header.pos]
+		if warnVisibility {
+			s.Warnings = append(s.Warnings, fmt.Sprintf("visibility unknown, %v", verr))
+			warnVisibility = false
+		}
+		checkOwner(header)
+		classify(header, size, cfg.bounds, verr == nil)
+		var signals []string
+		header.confidence, signals = confidence(f, header, size)
+		if cfg.explain {
+			header.explanation = explain(header, signals)
+		}
+		if len(first) < containerEntries {
+			first = append(first, header)
+		}
+		s.Entries++
+		if header.class == classHidden {
+			s.Hidden++
+		}
+		if header.class == classPhantom {
+			s.Phantom++
+		}
+		if isChained(f, header, size) {
+			s.Chained++
+		}
+		if cfg.reports(header) {
+			err = periodic.entry(header)
+		} else {
+			err = periodic.end()
+		}
 		if err != nil {
 			return err
 		}
-		fmt.Printf("%s at %d len %d\n", header.name, pos, header.size)
+		if cfg.scanEntry != "" && header.name == cfg.scanEntry {
+			// Keep nested entries after their container.
+			if err := periodic.end(); err != nil {
+				return err
+			}
+			if err := scanEntryContent(f, header, cfg, rep, s); err != nil {
+				return fmt.Errorf("scanning %s: %w", header.name, err)
+			}
+		}
+		if err := progress(); err != nil {
+			return err
+		}
+	}
+	if err := periodic.end(); err != nil {
+		return err
+	}
+	s.Warnings = append(s.Warnings, periodic.warnings...)
+	if cfg.checkpoint != nil {
+		if err := cfg.checkpoint.record(size, true); err != nil {
+			return fmt.Errorf("checkpoint: %w", err)
+		}
+	}
+	if cd != nil {
+		s.PhantomCentral = checkCentralOffsets(f, cd, data)
+		for _, p := range s.PhantomCentral {
+			s.Warnings = append(s.Warnings, p.String())
+		}
+	}
+	s.Warnings = append(s.Warnings, checkSharedData(cd, data)...)
+	var overrun int64
+	s.regions, overrun = clampRegions(regions, size)
+	if overrun > 0 {
+		s.Warnings = append(s.Warnings, fmt.Sprintf("structures claim %d bytes past the end of the file", overrun))
+	}
+	s.Accounted = coverage(spansOf(s.regions))
+	s.Container = containerType(first)
+	return nil
+}
+
+// isChainedStored reports whether h is a stored entry whose size is known
+// for sure, i.e. it is listed in the central directory or its data is
+// followed by another zip structure.
+func isChainedStored(r io.ReaderAt, h *FileHeader, size int64) bool {
+	if h.compression != 0 || h.csize == 0 {
+		return false
+	}
+	end := h.pos + int64(h.csize)
+	if end > size {
+		return false
 	}
+	if h.central != nil && h.central.csize == h.csize {
+		return true
+	}
+	return zipStructureAt(r, end)
+}
 
+// zipStructureAt reports whether one of the zip signatures is at pos.
+func zipStructureAt(r io.ReaderAt, pos int64) bool {
+	var sig [4]byte
+	if _, err := r.ReadAt(sig[:], pos); err != nil {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(sig[:]) {
+	case fileHeaderSignature, centralHeaderSignature, dataDescriptorSignature, endOfCentralDirSignature:
+		return true
+	}
+	return false
 }
 
-func main() {
-	if len(os.Args) != 2 {
-		fmt.Printf("Usage: %s <file.zip>\n", os.Args[0])
-		fmt.Println("Find hidden files in a Zip archive by looking for local file headers.")
+// scanEntryContent searches the decompressed content of h for nested
+// headers, which are reported as "outer!inner" with offsets relative to the
+// content.
+func scanEntryContent(f readSeekerAt, h *FileHeader, cfg *config, rep reporter, s *Summary) error {
+	rc, err := openEntry(f, h)
+	if err != nil {
+		return err
 	}
-	err := searchFileHeaders(os.Args[1])
+	content, cleanup, err := bufferInput(rc, cfg.spill)
+	rc.Close()
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
+	defer cleanup()
+
+	inner := *cfg
+	inner.scanEntry = ""
+	inner.start, inner.checkpoint, inner.skip = 0, nil, 0
+	var is Summary
+	err = scanFileHeaders(content, &inner, &prefixReporter{rep, h.name}, &is)
+	s.merge(&is, h.name+"!")
+	return err
 }
@@ -0,0 +1,306 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestNextFileHeaderRetry scans a run of back-to-back signatures, each of
+// which reads as a header whose name length exceeds 255 as the following
+// signatures make up its fields. The run spans several scan windows. Every
+// match has to be rejected exactly once before the real header following
+// them is found.
+func TestNextFileHeaderRetry(t *testing.T) {
+	const bad = 3 * scanWindow / 4
+	// The last signatures read their fields from the padding instead,
+	// which makes for equally bad lengths.
+	garbage := append(bytes.Repeat(fileHeaderSep, bad), bytes.Repeat([]byte{0xff}, 30)...)
+	archive := mustBuildFixture(t, []fixtureFile{{name: "a.txt", content: []byte("a"), method: zip.Store}})
+	r := bytes.NewReader(append(garbage, archive...))
+
+	var rejected []int64
+	reject := func(pos int64, raw []byte, reason string) {
+		if !strings.Contains(reason, "exceeds 255") {
+			t.Errorf("match at %d rejected for %q", pos, reason)
+		}
+		rejected = append(rejected, pos)
+	}
+	h, err := nextFileHeader(r, false, reject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.name != "a.txt" {
+		t.Errorf("found %q, want a.txt", h.name)
+	}
+	if len(rejected) != bad {
+		t.Fatalf("rejected %d matches, want %d", len(rejected), bad)
+	}
+	for i, pos := range rejected {
+		if want := int64(4 * i); pos != want {
+			t.Fatalf("rejection %d at %d, want %d", i, pos, want)
+		}
+	}
+	if _, err := nextFileHeader(r, false, reject); err != io.EOF {
+		t.Errorf("got %v after the last header, want EOF", err)
+	}
+}
+
+// rewindingSeeker resolves every relative seek backwards from the start
+// of the input, so the search for headers keeps getting sent back.
+type rewindingSeeker struct {
+	*bytes.Reader
+}
+
+func (r rewindingSeeker) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekCurrent && offset < 0 {
+		return r.Reader.Seek(4, io.SeekStart)
+	}
+	return r.Reader.Seek(offset, whence)
+}
+
+// TestNextFileHeaderProgress makes sure the search for headers ends even
+// if retrying doesn't move it forward.
+func TestNextFileHeaderProgress(t *testing.T) {
+	b := append(bytes.Repeat(fileHeaderSep, 16), bytes.Repeat([]byte{0xff}, 30)...)
+	done := make(chan error, 1)
+	go func() {
+		_, err := nextFileHeader(rewindingSeeker{bytes.NewReader(b)}, false, nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Errorf("got %v, want EOF", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the search for headers doesn't end")
+	}
+}
+
+// truncatedHeader returns a local file header for a.txt at the end of the
+// input whose extra field claims extralen bytes, of which only n follow.
+func truncatedHeader(extralen uint16, n int) []byte {
+	b := make([]byte, 30, 30+5+n)
+	copy(b, fileHeaderSep)
+	binary.LittleEndian.PutUint16(b[4:], 20)
+	binary.LittleEndian.PutUint16(b[26:], 5)
+	binary.LittleEndian.PutUint16(b[28:], extralen)
+	b = append(b, "a.txt"...)
+	return append(b, make([]byte, n)...)
+}
+
+func TestNextFileHeaderTruncatedExtra(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		b        []byte
+		strict   bool
+		extralen uint16
+		warning  string
+	}{
+		{"complete", truncatedHeader(4, 4), false, 4, ""},
+		{"truncated", truncatedHeader(200, 10), false, 10, "extra field truncated: 10 of 200 bytes"},
+		{"nothing left", truncatedHeader(200, 0), false, 0, "extra field truncated: 0 of 200 bytes"},
+		{"strict", truncatedHeader(200, 10), true, 0, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var rejected []string
+			h, err := nextFileHeader(bytes.NewReader(tc.b), tc.strict, func(pos int64, raw []byte, reason string) {
+				rejected = append(rejected, reason)
+			})
+			if tc.strict {
+				if err != io.EOF || len(rejected) != 1 {
+					t.Errorf("got %v with rejections %q, want EOF after one rejection", err, rejected)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.name != "a.txt" || h.extralen != tc.extralen || len(h.extra) != int(tc.extralen) {
+				t.Errorf("got %q with extralen %d and %d extra bytes, want a.txt with %d", h.name, h.extralen, len(h.extra), tc.extralen)
+			}
+			if got := strings.Join(h.warnings, "; "); got != tc.warning {
+				t.Errorf("warnings %q, want %q", got, tc.warning)
+			}
+			if want := int64(len(tc.b)); h.pos != want {
+				t.Errorf("data at %d, want %d", h.pos, want)
+			}
+		})
+	}
+}
+
+// FuzzScan checks that no input makes the scanner panic. The corpus in
+// testdata/fuzz/FuzzScan holds inputs that used to.
+func FuzzScan(f *testing.F) {
+	f.Add(mustBuildFixture(f, selftestFiles))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, opts := range [][]Option{nil, {WithValidate(), WithHash()}} {
+			// Errors are fine, only panics aren't.
+			r := bytes.NewReader(b)
+			Analyze(r, r.Size(), opts...)
+		}
+	})
+}
+
+// smallEntries builds an archive with n entries of a few bytes each.
+func smallEntries(b *testing.B, n int) []byte {
+	b.Helper()
+	files := make([]fixtureFile, n)
+	for i := range files {
+		files[i] = fixtureFile{name: fmt.Sprintf("dir/%d.txt", i), content: []byte(fmt.Sprint(i)), method: zip.Store}
+	}
+	return mustBuildFixture(b, files)
+}
+
+// BenchmarkNextFileHeader searches an archive of 50k small entries for
+// local headers, the path the header buffer pool is for.
+func BenchmarkNextFileHeader(b *testing.B) {
+	data := smallEntries(b, 50000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := bytes.NewReader(data)
+		n := 0
+		for {
+			_, err := nextFileHeader(r, false, nil)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+			n++
+		}
+		if n != 50000 {
+			b.Fatalf("found %d headers, want 50000", n)
+		}
+	}
+}
+
+// BenchmarkScanManyEntries runs the whole scan over an archive of 50k
+// small entries.
+func BenchmarkScanManyEntries(b *testing.B) {
+	data := smallEntries(b, 50000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := bytes.NewReader(data)
+		headers, err := ScanReaderAt(r, r.Size())
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(headers) != 50000 {
+			b.Fatalf("found %d headers, want 50000", len(headers))
+		}
+	}
+}
+
+// scanReaderIndexByte is scanReader looking for the first byte of sep with
+// bytes.IndexByte and checking the rest by hand, for comparison.
+func scanReaderIndexByte(r io.Reader, sep []byte, buf []byte) ([]byte, error) {
+	start := 0
+	for {
+		n, err := r.Read(buf[start:])
+		if err != nil {
+			return nil, err
+		}
+		n += start
+		for i := 0; i+len(sep) <= n; {
+			j := bytes.IndexByte(buf[i:n-len(sep)+1], sep[0])
+			if j < 0 {
+				break
+			}
+			i += j
+			if bytes.Equal(buf[i+1:i+len(sep)], sep[1:]) {
+				return buf[i+len(sep) : n], nil
+			}
+			i++
+		}
+		start = len(sep) - 1
+		if n < start {
+			start = n
+		}
+		copy(buf[:start], buf[n-start:n])
+	}
+}
+
+// BenchmarkScanReader compares finding a signature with bytes.Index to
+// skipping to its first byte with bytes.IndexByte, over data without
+// other matches like compressed content and over text with many 'P's.
+func BenchmarkScanReader(b *testing.B) {
+	random := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(random)
+	random = bytes.ReplaceAll(random, []byte("PK"), []byte("QK"))
+	text := bytes.Repeat([]byte("Pack the PDF with the PNG Pictures. "), (4<<20)/36)
+	for _, data := range []struct {
+		name string
+		b    []byte
+	}{{"random", random}, {"text", text}} {
+		input := append(append([]byte(nil), data.b...), fileHeaderSep...)
+		for _, strategy := range []struct {
+			name string
+			scan func(io.Reader, []byte, []byte) ([]byte, error)
+		}{{"Index", scanReader}, {"IndexByte", scanReaderIndexByte}} {
+			b.Run(data.name+"/"+strategy.name, func(b *testing.B) {
+				buf := make([]byte, scanWindow)
+				b.SetBytes(int64(len(input)))
+				for i := 0; i < b.N; i++ {
+					rest, err := strategy.scan(bytes.NewReader(input), fileHeaderSep, buf)
+					if err != nil || len(rest) != 0 {
+						b.Fatalf("got %d bytes after the signature, error %v", len(rest), err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestScanPrefix scans only the first of two archives in a reader, which
+// must not turn up the entries of the second.
+func TestScanPrefix(t *testing.T) {
+	first := mustBuildFixture(t, []fixtureFile{{name: "a.txt", content: []byte("a"), method: zip.Store}})
+	second := mustBuildFixture(t, []fixtureFile{{name: "b.txt", content: []byte("b"), method: zip.Store}})
+	r := bytes.NewReader(append(append([]byte(nil), first...), second...))
+	size := int64(len(first))
+
+	headers, err := ScanReaderAt(r, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 1 || headers[0].name != "a.txt" {
+		t.Errorf("ScanReaderAt found %d headers, want only a.txt", len(headers))
+	}
+	res, err := Analyze(r, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Entries) != 1 || res.Entries[0].name != "a.txt" {
+		t.Errorf("Analyze found %d entries, want only a.txt", len(res.Entries))
+	}
+	if res.Summary.Hidden != 0 || len(res.Segments) != 1 || res.Segments[0].End != size {
+		t.Errorf("Analyze sees %d hidden entries and segments %v, want none and one up to %d", res.Summary.Hidden, res.Segments, size)
+	}
+}
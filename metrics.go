@@ -0,0 +1,96 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// metrics adds up the summaries of a run for -metrics. It is safe for
+// concurrent use.
+type metrics struct {
+	mu       sync.Mutex
+	start    time.Time
+	files    int
+	failed   int
+	bytes    int64
+	entries  int
+	phantom  int
+	rejected int
+}
+
+func newMetrics() *metrics {
+	return &metrics{start: time.Now()}
+}
+
+// reporter returns a reporter that counts the summary of a scan before
+// passing it on to rep.
+func (m *metrics) reporter(rep reporter) reporter {
+	return &metricsReporter{rep, m}
+}
+
+type metricsReporter struct {
+	reporter
+	m *metrics
+}
+
+func (r *metricsReporter) summary(s *Summary) error {
+	r.m.mu.Lock()
+	r.m.files++
+	if s.Reason == reasonError {
+		r.m.failed++
+	}
+	r.m.bytes += s.Size
+	r.m.entries += s.Entries
+	r.m.phantom += s.Phantom
+	r.m.rejected += len(s.Rejected)
+	r.m.mu.Unlock()
+	return r.reporter.summary(s)
+}
+
+// write prints the metrics to w, as a single line or in the Prometheus text
+// format.
+func (m *metrics) write(w io.Writer, prometheus bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elapsed := time.Since(m.start)
+	throughput := float64(m.bytes) / elapsed.Seconds()
+	if !prometheus {
+		_, err := fmt.Fprintf(w, "metrics: %d files (%d failed), %d bytes scanned, %d entries, %d phantom, %d rejected, %v elapsed, %.2f MB/s\n",
+			m.files, m.failed, m.bytes, m.entries, m.phantom, m.rejected, elapsed.Round(time.Microsecond), throughput/1e6)
+		return err
+	}
+	for _, p := range []struct {
+		name, typ, help string
+		value           any
+	}{
+		{"files_total", "counter", "Files scanned.", m.files},
+		{"files_failed_total", "counter", "Files whose scan ended with an error.", m.failed},
+		{"bytes_scanned_total", "counter", "Bytes of input searched for headers.", m.bytes},
+		{"entries_total", "counter", "Entries found.", m.entries},
+		{"phantom_total", "counter", "Signature matches failing the validity checks.", m.phantom},
+		{"rejected_total", "counter", "Signature matches not taken as headers, with -show-rejects.", m.rejected},
+		{"elapsed_seconds", "gauge", "Duration of the run.", elapsed.Seconds()},
+		{"throughput_bytes_per_second", "gauge", "Bytes scanned per second.", throughput},
+	} {
+		if _, err := fmt.Fprintf(w, "# HELP hidden_zip_%s %s\n# TYPE hidden_zip_%s %s\nhidden_zip_%s %v\n", p.name, p.help, p.name, p.typ, p.name, p.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,605 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reasons for a scan to end, as reported in Summary.Reason.
+const (
+	reasonEOF    = "eof"
+	reasonError  = "error"
+	reasonNotZip = "not-zip"
+)
+
+// Summary describes a finished scan.
+type Summary struct {
+	Entries    int `json:"entries"`
+	Suppressed int `json:"suppressed"`
+	// Hidden counts the entries that archive/zip doesn't list, leaving out
+	// phantom ones, which Phantom counts.
+	Hidden int `json:"hidden"`
+	// Phantom counts the signature matches that fail the validity checks.
+	Phantom int `json:"phantom"`
+	// Chained counts the entries that are part of a coherent archive,
+	// listed in the central directory or followed by another structure.
+	Chained int    `json:"chained"`
+	Reason  string `json:"reason"`
+	Error   string `json:"error,omitempty"`
+
+	// Size is the size of the file, Accounted the number of bytes taken up
+	// by entries and the central directory. The rest is slack that may
+	// hide data.
+	Size      int64 `json:"size"`
+	Accounted int64 `json:"accounted"`
+
+	// FirstHeader is the position of the first local file header, EOCD
+	// that of the end of central directory record. Data before the first
+	// header means the archive is embedded, e.g. behind an SFX stub.
+	FirstHeader *int64 `json:"firstHeader"`
+	EOCD        *int64 `json:"eocd"`
+	// Prefix and Trailing count the bytes before the first header and
+	// after the end of central directory record.
+	Prefix   int64 `json:"prefix"`
+	Trailing int64 `json:"trailing"`
+
+	// Inflated names the compression of an input that was decompressed
+	// before scanning, offsets then refer to the decompressed data.
+	Inflated string `json:"inflated,omitempty"`
+
+	// Start is the offset a resumed search for headers started at.
+	// Skipped counts the bytes of a known stub that weren't searched.
+	Start   int64 `json:"start,omitempty"`
+	Skipped int64 `json:"skipped,omitempty"`
+
+	// Container names the zip based format of the archive, like
+	// "ooxml/docx" or "jar".
+	Container string `json:"container,omitempty"`
+
+	// CommentLength is the length of the archive comment. Comment is only
+	// filled in on request.
+	CommentLength int    `json:"commentLength"`
+	Comment       string `json:"comment,omitempty"`
+
+	// SigningBlock is the APK Signing Block in front of the central
+	// directory, if any.
+	SigningBlock *SigningBlock `json:"signingBlock,omitempty"`
+
+	// PhantomCentral lists the central directory records that point to
+	// no local header.
+	PhantomCentral []PhantomCentral `json:"phantomCentral,omitempty"`
+
+	// Rejected lists the signature matches that weren't taken as
+	// headers, with -show-rejects.
+	Rejected []Rejection `json:"rejected,omitempty"`
+
+	// Warnings lists anomalies concerning the archive as a whole.
+	Warnings []string `json:"warnings,omitempty"`
+
+	// regions are the structures making up Accounted.
+	regions []region
+	// resume is the data position of the last header found, where a scan of
+	// appended data can continue.
+	resume int64
+}
+
+// foundZip reports whether the scan found any zip structure: an entry or
+// an end of central directory record.
+func (s *Summary) foundZip() bool {
+	return s.Entries > 0 || s.Suppressed > 0 || s.EOCD != nil
+}
+
+// merge adds the counts, warnings and phantom central directory records of
+// the nested scan o to s. prefix is that of the entries of o, which also
+// goes in front of the names of its phantom records, while its warnings
+// name it without the trailing "!". Warnings and records s already has are
+// left out, as repeated scans of the same data find them again.
+func (s *Summary) merge(o *Summary, prefix string) {
+	s.Entries += o.Entries
+	s.Suppressed += o.Suppressed
+	s.Hidden += o.Hidden
+	s.Phantom += o.Phantom
+	s.Chained += o.Chained
+	label := strings.TrimSuffix(prefix, "!")
+	for _, w := range o.Warnings {
+		if label != "" {
+			w = label + ": " + w
+		}
+		if !containsString(s.Warnings, w) {
+			s.Warnings = append(s.Warnings, w)
+		}
+	}
+next:
+	for _, p := range o.PhantomCentral {
+		p.Name = prefix + p.Name
+		for _, q := range s.PhantomCentral {
+			if p == q {
+				continue next
+			}
+		}
+		s.PhantomCentral = append(s.PhantomCentral, p)
+	}
+}
+
+// containsString reports whether list contains s.
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Rejection is a signature match that isn't a plausible header.
+type Rejection struct {
+	Offset int64 `json:"offset"`
+	// Raw holds the signature and fixed header fields in hex.
+	Raw    string `json:"raw"`
+	Reason string `json:"reason"`
+}
+
+// reporter renders scan results. entry is called for every reported entry
+// in scan order, summary once at the end, even if the scan failed.
+type reporter interface {
+	entry(h *FileHeader) error
+	summary(s *Summary) error
+}
+
+type textReporter struct {
+	w       io.Writer
+	cfg     *config
+	verbose bool
+	color   bool
+	// fields replaces the default line with the selected fields.
+	fields []field
+}
+
+func (t *textReporter) entry(h *FileHeader) error {
+	if t.fields != nil {
+		return t.println(strings.Join(fieldValues(t.fields, h, nil), " "), h)
+	}
+	// Don't let names mess with the terminal.
+	name := h.name
+	if hasHiddenRunes(name) {
+		name = strconv.Quote(name)
+	}
+	var line string
+	if !t.verbose {
+		line = fmt.Sprintf("%s at %d len %d", name, h.pos, h.size)
+	} else {
+		line = fmt.Sprintf("%s at %d len %d csize %d crc32 %08x method %d version %d flags %#04x [%s]",
+			name, h.pos, h.size, h.csize, h.crc32, h.compression, h.version, h.flags, decodeFlags(h.flags))
+		if h.sizeSource != sizeDeclared {
+			line += " sizes " + h.sizeSource
+		}
+		line += fmt.Sprintf(" modified %s (%s)", h.modTime.Format(time.RFC3339), h.modTimeSource)
+		if h.owner != nil {
+			line += fmt.Sprintf(" owner %d:%d", h.owner.uid, h.owner.gid)
+		}
+		if c := h.central; c != nil {
+			line += fmt.Sprintf(" disk %d iattr %#x eattr %#x", c.diskStart, c.internalAttrs, c.externalAttrs)
+			if mode, ok := c.unixMode(); ok {
+				line += fmt.Sprintf(" mode %o", mode)
+			}
+			line += fmt.Sprintf(" header offset %d", c.headerOffset)
+		}
+	}
+	if h.hash != "" {
+		line += " sha256 " + h.hash
+	}
+	if h.decryption == decryptionOK {
+		line += " decrypted"
+	}
+	if h.integrity != "" {
+		line += " integrity " + h.integrity
+	}
+	if h.entropy != nil {
+		line += fmt.Sprintf(" entropy %.2f", *h.entropy)
+	}
+	if h.innerSignatures > 0 {
+		line += fmt.Sprintf(" %d inner signature matches", h.innerSignatures)
+	}
+	if h.IsDir() {
+		line += " directory"
+	}
+	if h.class == classHidden {
+		line += " hidden"
+	}
+	if h.class == classPhantom {
+		line += " phantom: " + strings.Join(h.phantomReasons, ", ")
+	}
+	if h.confidence < maxConfidence || t.verbose {
+		line += fmt.Sprintf(" confidence %d", h.confidence)
+	}
+	switch {
+	case t.cfg.explain:
+		// The explanation includes the warnings.
+		if len(h.explanation) > 0 {
+			line += " explained: " + strings.Join(h.explanation, "; ")
+		}
+	case len(h.warnings) > 0:
+		line += " (" + strings.Join(h.warnings, "; ") + ")"
+	}
+	return t.println(line, h)
+}
+
+// println writes the line describing h.
+func (t *textReporter) println(line string, h *FileHeader) error {
+	if t.color {
+		line = colorize(line, h)
+	}
+	_, err := fmt.Fprintln(t.w, line)
+	return err
+}
+
+func (t *textReporter) summary(s *Summary) error {
+	if s.Reason == reasonNotZip {
+		if _, err := fmt.Fprintln(t.w, "no zip structure found"); err != nil {
+			return err
+		}
+	}
+	if t.cfg.ignoreHashes != nil {
+		if _, err := fmt.Fprintf(t.w, "%d entries suppressed by -ignore-hashes\n", s.Suppressed); err != nil {
+			return err
+		}
+	}
+	if t.cfg.showComment && s.CommentLength > 0 {
+		if _, err := fmt.Fprintf(t.w, "comment (%d bytes): %q\n", s.CommentLength, s.Comment); err != nil {
+			return err
+		}
+	}
+	if s.Inflated != "" {
+		if _, err := fmt.Fprintf(t.w, "scanned %s-decompressed input, offsets are into the decompressed data\n", s.Inflated); err != nil {
+			return err
+		}
+	}
+	if s.Skipped > 0 {
+		if _, err := fmt.Fprintf(t.w, "skipped first %d bytes, offsets are from the start of the file\n", s.Skipped); err != nil {
+			return err
+		}
+	}
+	if s.Start > 0 {
+		if _, err := fmt.Fprintf(t.w, "scan started at offset %d, offsets are from the start of the file\n", s.Start); err != nil {
+			return err
+		}
+	}
+	if b := s.SigningBlock; b != nil {
+		var pairs []string
+		for _, p := range b.Pairs {
+			name := p.Name
+			if name == "" {
+				name = "unknown"
+			}
+			pairs = append(pairs, fmt.Sprintf("%s (%#08x, %d bytes at %d)", name, p.ID, p.Size, p.Offset))
+		}
+		if _, err := fmt.Fprintf(t.w, "APK signing block at %d len %d: %s\n", b.Offset, b.Size, strings.Join(pairs, ", ")); err != nil {
+			return err
+		}
+	}
+	for _, r := range s.Rejected {
+		if _, err := fmt.Fprintf(t.w, "rejected match at %d: %s\n  %s\n", r.Offset, r.Reason, r.Raw); err != nil {
+			return err
+		}
+	}
+	for _, w := range s.Warnings {
+		if _, err := fmt.Fprintln(t.w, "warning:", w); err != nil {
+			return err
+		}
+	}
+	if t.verbose {
+		return t.layout(s)
+	}
+	return nil
+}
+
+// layout describes where the archive structure starts and ends.
+func (t *textReporter) layout(s *Summary) error {
+	var parts []string
+	if s.FirstHeader != nil {
+		parts = append(parts, fmt.Sprintf("first header at %d", *s.FirstHeader))
+		if s.Prefix > 0 {
+			parts = append(parts, fmt.Sprintf("%d bytes of prefix", s.Prefix))
+		}
+	} else {
+		parts = append(parts, "no local file header")
+	}
+	if s.EOCD != nil {
+		parts = append(parts, fmt.Sprintf("end of central directory at %d", *s.EOCD))
+		if s.Trailing > 0 {
+			parts = append(parts, fmt.Sprintf("%d bytes of trailing data", s.Trailing))
+		}
+	} else {
+		parts = append(parts, "no end of central directory")
+	}
+	if s.Container != "" {
+		parts = append(parts, "container "+s.Container)
+	}
+	if s.Size > 0 {
+		parts = append(parts, fmt.Sprintf("accounted %d of %d bytes (%.1f%%)",
+			s.Accounted, s.Size, float64(s.Accounted)*100/float64(s.Size)))
+	}
+	_, err := fmt.Fprintln(t.w, strings.Join(parts, ", "))
+	return err
+}
+
+// namesReporter prints entry names and nothing else, for use in pipelines.
+type namesReporter struct {
+	w io.Writer
+}
+
+func (n *namesReporter) entry(h *FileHeader) error {
+	_, err := fmt.Fprintln(n.w, h.name)
+	return err
+}
+
+func (n *namesReporter) summary(s *Summary) error {
+	return nil
+}
+
+// tskReporter writes tab-separated carved-file records that forensic suites
+// such as Autopsy can import. The columns are:
+//
+//	offset       position of the local file header
+//	length       bytes from the local header to the end of the entry data
+//	name         entry name, with tab, newline and backslash escaped
+//	data_offset  position of the entry data
+//	csize        compressed size
+//	size         uncompressed size
+//	crc32        CRC-32 in hex
+//	method       compression method
+//
+// With -fields, the selected fields are written instead, with fields named
+// in the header row. Entries of nested scans are left out, as their offsets
+// refer to the content they were found in rather than the file.
+type tskReporter struct {
+	w      io.Writer
+	header bool
+	fields []field
+}
+
+var tskEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+func (t *tskReporter) entry(h *FileHeader) error {
+	if len(h.containers) > 0 {
+		return nil
+	}
+	if t.fields != nil {
+		return t.selected(h)
+	}
+	if !t.header {
+		t.header = true
+		if _, err := fmt.Fprintln(t.w, "offset\tlength\tname\tdata_offset\tcsize\tsize\tcrc32\tmethod"); err != nil {
+			return err
+		}
+	}
+	length := h.pos - h.headerPos() + int64(h.csize)
+	_, err := fmt.Fprintf(t.w, "%d\t%d\t%s\t%d\t%d\t%d\t%08x\t%d\n",
+		h.headerPos(), length, tskEscaper.Replace(h.name), h.pos, h.csize, h.size, h.crc32, h.compression)
+	return err
+}
+
+// selected writes the selected fields of h.
+func (t *tskReporter) selected(h *FileHeader) error {
+	if !t.header {
+		t.header = true
+		names := make([]string, len(t.fields))
+		for i, f := range t.fields {
+			names[i] = f.name
+		}
+		if _, err := fmt.Fprintln(t.w, strings.Join(names, "\t")); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(t.w, strings.Join(fieldValues(t.fields, h, tskEscaper.Replace), "\t"))
+	return err
+}
+
+func (t *tskReporter) summary(s *Summary) error {
+	return nil
+}
+
+// prefixReporter reports entries of a nested scan of container through
+// rep, naming them "container!name" and adding container to their chain.
+type prefixReporter struct {
+	rep       reporter
+	container string
+}
+
+func (p *prefixReporter) entry(h *FileHeader) error {
+	nested := *h
+	nested.name = p.container + "!" + h.name
+	nested.containers = append([]string{p.container}, h.containers...)
+	return p.rep.entry(&nested)
+}
+
+func (p *prefixReporter) summary(s *Summary) error {
+	return nil
+}
+
+// collector keeps all reported entries.
+type collector struct {
+	headers []FileHeader
+}
+
+func (c *collector) entry(h *FileHeader) error {
+	c.headers = append(c.headers, *h)
+	return nil
+}
+
+func (c *collector) summary(s *Summary) error {
+	return nil
+}
+
+// walkReporter passes entries to a Walk callback.
+type walkReporter func(FileHeader) error
+
+func (fn walkReporter) entry(h *FileHeader) error {
+	return fn(*h)
+}
+
+func (fn walkReporter) summary(s *Summary) error {
+	return nil
+}
+
+// entryWriter consumes the content of reported entries, e.g. to extract
+// them.
+type entryWriter interface {
+	write(h *FileHeader) error
+}
+
+// teeReporter passes every entry to w before reporting it through rep.
+type teeReporter struct {
+	rep reporter
+	w   entryWriter
+	// what describes w in messages.
+	what string
+}
+
+func (t *teeReporter) entry(h *FileHeader) error {
+	if err := t.w.write(h); err != nil {
+		// A single broken entry shouldn't stop the whole scan.
+		fmt.Fprintf(os.Stderr, "skipping %s in %s: %v\n", h.name, t.what, err)
+	}
+	return t.rep.entry(h)
+}
+
+func (t *teeReporter) summary(s *Summary) error {
+	return t.rep.summary(s)
+}
+
+// jsonEntry is the JSON representation of a FileHeader.
+type jsonEntry struct {
+	File        string       `json:"file,omitempty"`
+	Name        string       `json:"name"`
+	Offset      int64        `json:"offset"`
+	Size        uint32       `json:"size"`
+	CSize       uint32       `json:"csize"`
+	SizeSource  string       `json:"sizeSource"`
+	CRC32       uint32       `json:"crc32"`
+	Compression uint16       `json:"compression"`
+	Flags       uint16       `json:"flags"`
+	FlagBits    generalFlags `json:"flagBits"`
+	Version     uint16       `json:"version"`
+	Modified    string       `json:"modified"`
+	ModSource   string       `json:"modifiedSource"`
+	UID         *uint64      `json:"uid,omitempty"`
+	GID         *uint64      `json:"gid,omitempty"`
+	SHA256      string       `json:"sha256,omitempty"`
+	Dir         bool         `json:"directory,omitempty"`
+	Hidden      bool         `json:"hidden"`
+	Class       string       `json:"class"`
+	Phantom     []string     `json:"phantomReasons,omitempty"`
+	Confidence  int          `json:"confidence"`
+	Entropy     *float64     `json:"entropy,omitempty"`
+	Decryption  string       `json:"decryption,omitempty"`
+	Integrity   string       `json:"integrity,omitempty"`
+	InnerSigs   int          `json:"innerSignatures,omitempty"`
+	Warnings    []string     `json:"warnings,omitempty"`
+	Explanation []string     `json:"explanation,omitempty"`
+	Central     *jsonCentral `json:"central,omitempty"`
+}
+
+// jsonCentral holds the fields of the central directory record of an entry
+// that the local header lacks.
+type jsonCentral struct {
+	DiskStart     uint16  `json:"diskStart"`
+	InternalAttrs uint16  `json:"internalAttrs"`
+	ExternalAttrs uint32  `json:"externalAttrs"`
+	Mode          *uint32 `json:"mode,omitempty"`
+	HeaderOffset  uint32  `json:"headerOffset"`
+}
+
+func newJSONEntry(h *FileHeader) *jsonEntry {
+	e := &jsonEntry{
+		Name:        h.name,
+		Offset:      h.pos,
+		Size:        h.size,
+		CSize:       h.csize,
+		SizeSource:  h.sizeSource,
+		CRC32:       h.crc32,
+		Compression: h.compression,
+		Flags:       h.flags,
+		FlagBits:    decodeFlags(h.flags),
+		Version:     h.version,
+		Modified:    h.modTime.Format(time.RFC3339),
+		ModSource:   h.modTimeSource,
+		SHA256:      h.hash,
+		Dir:         h.IsDir(),
+		Hidden:      h.hidden,
+		Class:       h.class,
+		Phantom:     h.phantomReasons,
+		Confidence:  h.confidence,
+		Entropy:     h.entropy,
+		Decryption:  h.decryption,
+		Integrity:   h.integrity,
+		InnerSigs:   h.innerSignatures,
+		Warnings:    h.warnings,
+		Explanation: h.explanation,
+	}
+	if o := h.owner; o != nil {
+		e.UID, e.GID = &o.uid, &o.gid
+	}
+	if c := h.central; c != nil {
+		e.Central = &jsonCentral{
+			DiskStart:     c.diskStart,
+			InternalAttrs: c.internalAttrs,
+			ExternalAttrs: c.externalAttrs,
+			HeaderOffset:  c.headerOffset,
+		}
+		if mode, ok := c.unixMode(); ok {
+			e.Central.Mode = &mode
+		}
+	}
+	return e
+}
+
+// jsonReporter writes one JSON object per line. The last line is a
+// {"summary": ...} record, so consumers can tell a complete scan from a
+// truncated one: every line is a complete record, whenever the scan stops.
+// If file is set, every record names the scanned file.
+type jsonReporter struct {
+	enc  *json.Encoder
+	file string
+}
+
+// newJSONReporter returns a reporter writing JSON lines, or in pretty mode
+// a single indented document streamed by jsonDocument, preceded by prefix.
+func newJSONReporter(w io.Writer, pretty bool, file, prefix string) reporter {
+	if pretty {
+		return &jsonDocument{w: w, file: file, prefix: prefix}
+	}
+	return &jsonReporter{enc: json.NewEncoder(w), file: file}
+}
+
+func (j *jsonReporter) entry(h *FileHeader) error {
+	e := newJSONEntry(h)
+	e.File = j.file
+	return j.enc.Encode(e)
+}
+
+func (j *jsonReporter) summary(s *Summary) error {
+	return j.enc.Encode(struct {
+		File    string   `json:"file,omitempty"`
+		Summary *Summary `json:"summary"`
+	}{j.file, s})
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import "fmt"
+
+// Hidden headers following each other at a constant stride that is a
+// multiple of periodicAlign are collapsed into a single warning once there
+// are periodicRun of them. Such runs are typically signatures repeated as
+// padding rather than actual entries.
+const (
+	periodicAlign = 512
+	periodicRun   = 8
+)
+
+// periodicFilter passes entries on to rep, holding back runs of hidden
+// headers at a constant stride until it is clear whether they are periodic.
+type periodicFilter struct {
+	rep      reporter
+	warnings []string
+
+	start, last, stride int64
+	n                   int
+	pending             []*FileHeader
+}
+
+func (p *periodicFilter) entry(h *FileHeader) error {
+	pos := h.headerPos()
+	if h.hidden && p.n > 0 {
+		d := pos - p.last
+		if p.n == 1 && d > 0 && d%periodicAlign == 0 {
+			p.stride = d
+		}
+		if d == p.stride {
+			p.n++
+			p.last = pos
+			if p.n < periodicRun {
+				p.pending = append(p.pending, h)
+			} else {
+				p.pending = nil
+			}
+			return nil
+		}
+	}
+	if err := p.end(); err != nil {
+		return err
+	}
+	if !h.hidden {
+		return p.rep.entry(h)
+	}
+	p.start, p.last, p.stride, p.n = pos, pos, 0, 1
+	p.pending = append(p.pending, h)
+	return nil
+}
+
+// end finishes the current run, reporting the held back entries unless
+// the run is periodic.
+func (p *periodicFilter) end() error {
+	if p.n >= periodicRun {
+		p.warnings = append(p.warnings, fmt.Sprintf(
+			"periodic signature pattern: %d headers from %d every %d bytes, likely padding/false positives",
+			p.n, p.start, p.stride))
+	}
+	pending := p.pending
+	p.n, p.pending = 0, nil
+	for _, h := range pending {
+		if err := p.rep.entry(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+//go:generate go run proto_gen.go
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed32 = 5
+	wireBytes   = 2
+)
+
+// protoMessage encodes the fields of a protobuf message. Only what the
+// records of hidden_zip.proto need is supported, which saves depending on
+// the protobuf module for a handful of fields. Zero values are left out,
+// as proto3 does.
+type protoMessage []byte
+
+func (m protoMessage) tag(field, wire int) protoMessage {
+	return m.varint(uint64(field)<<3 | uint64(wire))
+}
+
+func (m protoMessage) varint(v uint64) protoMessage {
+	var buf [binary.MaxVarintLen64]byte
+	return append(m, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func (m protoMessage) uint(field int, v uint64) protoMessage {
+	if v == 0 {
+		return m
+	}
+	return m.tag(field, wireVarint).varint(v)
+}
+
+// int encodes v as a two's complement int64, like protobuf does.
+func (m protoMessage) int(field int, v int64) protoMessage {
+	return m.uint(field, uint64(v))
+}
+
+func (m protoMessage) bool(field int, v bool) protoMessage {
+	if !v {
+		return m
+	}
+	return m.uint(field, 1)
+}
+
+func (m protoMessage) fixed32(field int, v uint32) protoMessage {
+	if v == 0 {
+		return m
+	}
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(m.tag(field, wireFixed32), buf[:]...)
+}
+
+func (m protoMessage) bytes(field int, b []byte) protoMessage {
+	return append(m.tag(field, wireBytes).varint(uint64(len(b))), b...)
+}
+
+func (m protoMessage) string(field int, s string) protoMessage {
+	if s == "" {
+		return m
+	}
+	return m.bytes(field, []byte(s))
+}
+
+func (m protoMessage) strings(field int, ss []string) protoMessage {
+	for _, s := range ss {
+		m = m.bytes(field, []byte(s))
+	}
+	return m
+}
+
+// protoReporter writes length-delimited Record messages as defined in
+// hidden_zip.proto: one per entry and a final one with the summary. If
+// file is set, every record names the scanned file. The field numbers are
+// generated from the schema into proto_fields.go.
+type protoReporter struct {
+	w    io.Writer
+	file string
+}
+
+func (p *protoReporter) entry(h *FileHeader) error {
+	var modified int64
+	if !h.modTime.IsZero() {
+		modified = h.modTime.Unix()
+	}
+	e := protoMessage(nil).
+		string(protoEntryFile, p.file).
+		string(protoEntryName, h.name).
+		int(protoEntryOffset, h.pos).
+		uint(protoEntrySize, uint64(h.size)).
+		uint(protoEntryCsize, uint64(h.csize)).
+		fixed32(protoEntryCrc32, h.crc32).
+		uint(protoEntryCompression, uint64(h.compression)).
+		uint(protoEntryFlags, uint64(h.flags)).
+		uint(protoEntryVersion, uint64(h.version)).
+		int(protoEntryModified, modified).
+		string(protoEntrySha256, h.hash).
+		bool(protoEntryHidden, h.hidden).
+		string(protoEntryClass, h.class).
+		uint(protoEntryConfidence, uint64(h.confidence)).
+		string(protoEntryIntegrity, h.integrity).
+		strings(protoEntryWarnings, h.warnings).
+		bool(protoEntryDirectory, h.IsDir())
+	return p.write(protoMessage(nil).bytes(protoRecordEntry, e))
+}
+
+func (p *protoReporter) summary(s *Summary) error {
+	m := protoMessage(nil).
+		string(protoSummaryFile, p.file).
+		uint(protoSummaryEntries, uint64(s.Entries)).
+		uint(protoSummarySuppressed, uint64(s.Suppressed)).
+		uint(protoSummaryHidden, uint64(s.Hidden)).
+		uint(protoSummaryPhantom, uint64(s.Phantom)).
+		uint(protoSummaryChained, uint64(s.Chained)).
+		string(protoSummaryReason, s.Reason).
+		string(protoSummaryError, s.Error).
+		int(protoSummarySize, s.Size).
+		int(protoSummaryAccounted, s.Accounted).
+		strings(protoSummaryWarnings, s.Warnings)
+	return p.write(protoMessage(nil).bytes(protoRecordSummary, m))
+}
+
+// write writes the record r with its length prefixed.
+func (p *protoReporter) write(r protoMessage) error {
+	_, err := p.w.Write(append(protoMessage(nil).varint(uint64(len(r))), r...))
+	return err
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build ignore
+
+// proto_gen.go writes proto_fields.go, the field numbers of the messages in
+// hidden_zip.proto as constants, so the schema is the only place they are
+// defined. Run it with go generate after changing the schema.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	messageRe = regexp.MustCompile(`^message (\w+) \{$`)
+	fieldRe   = regexp.MustCompile(`^(?:repeated )?\w+ (\w+) = (\d+);$`)
+)
+
+func main() {
+	out := flag.String("o", "proto_fields.go", "write the constants to `file`, - for stdout")
+	flag.Parse()
+	license, err := os.ReadFile("proto_gen.go")
+	if err != nil {
+		log.Fatal(err)
+	}
+	schema, err := os.Open("hidden_zip.proto")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer schema.Close()
+
+	var buf bytes.Buffer
+	// The generated file carries the license header of this one.
+	buf.Write(license[:bytes.Index(license, []byte("\n\n"))+2])
+	buf.WriteString("// Code generated by proto_gen.go from hidden_zip.proto. DO NOT EDIT.\n\n")
+	buf.WriteString("package main\n\n")
+	buf.WriteString("// Field numbers of the messages in hidden_zip.proto.\nconst (\n")
+	message := ""
+	s := bufio.NewScanner(schema)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if m := messageRe.FindStringSubmatch(line); m != nil {
+			message = m[1]
+			buf.WriteString("\n")
+			continue
+		}
+		if m := fieldRe.FindStringSubmatch(line); m != nil && message != "" {
+			fmt.Fprintf(&buf, "\tproto%s%s = %s\n", message, camel(m[1]), m[2])
+		}
+	}
+	if err := s.Err(); err != nil {
+		log.Fatal(err)
+	}
+	buf.WriteString(")\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *out == "-" {
+		_, err = os.Stdout.Write(src)
+	} else {
+		err = os.WriteFile(*out, src, 0644)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// camel turns a snake_case field name into CamelCase.
+func camel(name string) string {
+	parts := strings.Split(name, "_")
+	for i, p := range parts {
+		if p != "" {
+			parts[i] = strings.ToUpper(p[:1]) + p[1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
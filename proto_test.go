@@ -0,0 +1,96 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// TestProtoFieldsUpToDate regenerates proto_fields.go from the schema and
+// compares it with the checked in file.
+func TestProtoFieldsUpToDate(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not available")
+	}
+	got, err := exec.Command("go", "run", "proto_gen.go", "-o", "-").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("proto_fields.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("proto_fields.go is out of date, run go generate")
+	}
+}
+
+func TestProtoEntryRecord(t *testing.T) {
+	var buf bytes.Buffer
+	p := &protoReporter{w: &buf}
+	if err := p.entry(&FileHeader{name: "a.txt", pos: 35, size: 5}); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	n, k := binary.Uvarint(b)
+	if k <= 0 || int(n) != len(b)-k {
+		t.Fatalf("length prefix %d doesn't match the %d byte record", n, len(b)-k)
+	}
+	fields := protoFields(t, b[k:])
+	entry, ok := fields[protoRecordEntry]
+	if !ok {
+		t.Fatalf("record has no entry: %x", b)
+	}
+	e := protoFields(t, entry)
+	if string(e[protoEntryName]) != "a.txt" {
+		t.Errorf("name is %q, want a.txt", e[protoEntryName])
+	}
+	if v, _ := binary.Uvarint(e[protoEntryOffset]); v != 35 {
+		t.Errorf("offset is %d, want 35", v)
+	}
+}
+
+// protoFields decodes the varint and length-delimited fields of a message,
+// keeping the raw value of each.
+func protoFields(t *testing.T, b []byte) map[int][]byte {
+	t.Helper()
+	fields := make(map[int][]byte)
+	for len(b) > 0 {
+		tag, k := binary.Uvarint(b)
+		if k <= 0 {
+			t.Fatalf("bad tag in %x", b)
+		}
+		b = b[k:]
+		field := int(tag >> 3)
+		switch tag & 7 {
+		case wireVarint:
+			_, k = binary.Uvarint(b)
+			fields[field], b = b[:k], b[k:]
+		case wireBytes:
+			n, k := binary.Uvarint(b)
+			b = b[k:]
+			fields[field], b = b[:n], b[n:]
+		case wireFixed32:
+			fields[field], b = b[:4], b[4:]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+	}
+	return fields
+}
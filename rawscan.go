@@ -0,0 +1,78 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+)
+
+// rawScanChunk is how much -raw-scan reads at a time.
+const rawScanChunk = 1 << 20
+
+// rawScan writes the offset of every local file header signature in
+// filename to w, one per line, without reading any headers. The input is
+// read sequentially, so pipes need no buffering.
+func rawScan(filename string, w io.Writer) error {
+	r := io.Reader(os.Stdin)
+	if filename != "-" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return newOpenError(filename, err)
+		}
+		defer f.Close()
+		if fi, err := f.Stat(); err == nil && fi.IsDir() {
+			return newOpenError(filename, errIsDir)
+		}
+		r = f
+	}
+	out := bufio.NewWriter(w)
+	buf := make([]byte, rawScanChunk+len(fileHeaderSep)-1)
+	// keep bytes at the end of a chunk are searched again with the next
+	// one, so matches across chunks aren't missed. base is the offset of
+	// buf[0].
+	var base int64
+	keep := 0
+	var line []byte
+	for {
+		n, err := io.ReadFull(r, buf[keep:])
+		n += keep
+		for i := 0; ; {
+			idx := bytes.Index(buf[i:n], fileHeaderSep)
+			if idx < 0 {
+				break
+			}
+			i += idx
+			line = strconv.AppendInt(line[:0], base+int64(i), 10)
+			line = append(line, '\n')
+			if _, err := out.Write(line); err != nil {
+				return err
+			}
+			i += len(fileHeaderSep)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return out.Flush()
+		}
+		if err != nil {
+			return err
+		}
+		keep = len(fileHeaderSep) - 1
+		copy(buf, buf[n-keep:n])
+		base += int64(n - keep)
+	}
+}
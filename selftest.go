@@ -0,0 +1,114 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// selftestFiles make up the archive of the self-test: a stored and a
+// deflated entry with an entry between them that the central directory
+// doesn't list.
+var selftestFiles = []fixtureFile{
+	{name: "readme.txt", content: []byte("hidden_zip self-test\n"), method: zip.Store},
+	{name: "payload.bin", content: bytes.Repeat([]byte("not in the central directory "), 20), method: zip.Deflate, hidden: true},
+	{name: "data.txt", content: bytes.Repeat([]byte("0123456789"), 100), method: zip.Deflate},
+}
+
+// selftest builds the self-test archive with archive/zip, scans it and
+// checks the results, printing PASS or FAIL for each check to w. It reports
+// whether all checks passed.
+func selftest(w io.Writer) bool {
+	ok := true
+	check := func(name string, err error) {
+		if err != nil {
+			ok = false
+			fmt.Fprintf(w, "FAIL %s: %v\n", name, err)
+		} else {
+			fmt.Fprintf(w, "PASS %s\n", name)
+		}
+	}
+
+	b, err := buildFixture(selftestFiles)
+	check("build", err)
+	if err != nil {
+		return false
+	}
+	r := bytes.NewReader(b)
+	res, err := Analyze(r, r.Size(), WithValidate())
+	check("scan", err)
+	if err != nil {
+		return false
+	}
+
+	check("entries found", func() error {
+		if len(res.Entries) != len(selftestFiles) {
+			return fmt.Errorf("found %d entries, want %d", len(res.Entries), len(selftestFiles))
+		}
+		for i, h := range res.Entries {
+			if h.name != selftestFiles[i].name {
+				return fmt.Errorf("entry %d is %q, want %q", i, h.name, selftestFiles[i].name)
+			}
+		}
+		return nil
+	}())
+	if len(res.Entries) != len(selftestFiles) {
+		return false
+	}
+	check("hidden entry detected", func() error {
+		for i, h := range res.Entries {
+			if h.hidden != selftestFiles[i].hidden {
+				return fmt.Errorf("%s: hidden is %v, want %v", h.name, h.hidden, selftestFiles[i].hidden)
+			}
+		}
+		if res.Summary.Hidden != 1 {
+			return fmt.Errorf("summary counts %d hidden entries, want 1", res.Summary.Hidden)
+		}
+		return nil
+	}())
+	check("content integrity", func() error {
+		for i, h := range res.Entries {
+			if h.integrity != integrityOK {
+				return fmt.Errorf("%s: integrity %s", h.name, h.integrity)
+			}
+			rc, err := openEntry(r, &res.Entries[i])
+			if err != nil {
+				return fmt.Errorf("%s: %w", h.name, err)
+			}
+			content, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", h.name, err)
+			}
+			if !bytes.Equal(content, selftestFiles[i].content) {
+				return fmt.Errorf("%s: content differs", h.name)
+			}
+		}
+		return nil
+	}())
+	check("central directory comparison", func() error {
+		if res.Central == nil {
+			return fmt.Errorf("archive/zip can't open the archive")
+		}
+		if len(res.Central.ScannerOnly) != 1 || res.Central.ScannerOnly[0].name != "payload.bin" {
+			return fmt.Errorf("%d entries only found by the scanner, want payload.bin", len(res.Central.ScannerOnly))
+		}
+		return nil
+	}())
+	return ok
+}
@@ -0,0 +1,191 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Where the sizes of an entry come from, see FileHeader.sizeSource.
+const (
+	sizeDeclared   = "declared"
+	sizeCentral    = "central"
+	sizeDescriptor = "descriptor"
+	sizeInferred   = "inferred"
+)
+
+// structureSignatures are the signatures that can follow entry data.
+var structureSignatures = map[uint32]bool{
+	fileHeaderSignature:      true,
+	centralHeaderSignature:   true,
+	endOfCentralDirSignature: true,
+	dataDescriptorSignature:  true,
+}
+
+// findNextStructure returns the position and signature of the first zip
+// structure at or after from.
+func findNextStructure(r io.ReaderAt, from, size int64) (int64, uint32, bool) {
+	buf := make([]byte, 64<<10)
+	for pos := from; pos < size; pos += int64(len(buf) - 3) {
+		n, err := r.ReadAt(buf, pos)
+		if n < 4 && err != nil {
+			return 0, 0, false
+		}
+		for i := 0; i+4 <= n; i++ {
+			if buf[i] != 'P' || buf[i+1] != 'K' {
+				continue
+			}
+			if sig := binary.LittleEndian.Uint32(buf[i:]); structureSignatures[sig] {
+				return pos + int64(i), sig, true
+			}
+		}
+		if n < len(buf) {
+			break
+		}
+	}
+	return 0, 0, false
+}
+
+// countSignatures counts the zip structure signatures within the data of h,
+// which hint at nested or overlapping content.
+func countSignatures(r io.ReaderAt, h *FileHeader, size int64) int {
+	end := h.pos + int64(h.csize)
+	if end > size {
+		end = size
+	}
+	n := end - h.pos
+	if n < 4 {
+		return 0
+	}
+	if n > 64<<10 {
+		n = 64 << 10
+	}
+	buf := make([]byte, n)
+	count := 0
+	for pos := h.pos; pos+4 <= end; pos += int64(len(buf) - 3) {
+		if rem := end - pos; rem < int64(len(buf)) {
+			buf = buf[:rem]
+		}
+		m, _ := r.ReadAt(buf, pos)
+		for i := 0; i+4 <= m; i++ {
+			if buf[i] == 'P' && buf[i+1] == 'K' && structureSignatures[binary.LittleEndian.Uint32(buf[i:])] {
+				count++
+			}
+		}
+		if m < len(buf) {
+			break
+		}
+	}
+	return count
+}
+
+// recoverSizes fills in the sizes of an entry with a data descriptor, which
+// has zeros in its local header. It prefers the central directory, then
+// the data descriptor and falls back to the distance to the next structure.
+func recoverSizes(r io.ReaderAt, h *FileHeader, size int64) {
+	h.sizeSource = sizeDeclared
+	if h.flags&0x8 == 0 && h.csize == 0 && h.size == 0 {
+		recoverZeroSizes(r, h, size)
+		return
+	}
+	if h.flags&0x8 == 0 || h.csize != 0 {
+		return
+	}
+	if c := h.central; c != nil && c.csize != 0 {
+		h.crc32, h.csize, h.size = c.crc32, c.csize, c.size
+		h.sizeSource = sizeCentral
+		return
+	}
+
+	// Data descriptors are crc32, csize and size, optionally preceded by
+	// their signature.
+	var d [16]byte
+	for from := h.pos; ; {
+		next, sig, ok := findNextStructure(r, from, size)
+		if !ok {
+			return
+		}
+		if sig == dataDescriptorSignature {
+			if _, err := r.ReadAt(d[:], next); err == nil && int64(binary.LittleEndian.Uint32(d[8:])) == next-h.pos {
+				h.crc32 = binary.LittleEndian.Uint32(d[4:])
+				h.csize = binary.LittleEndian.Uint32(d[8:])
+				h.size = binary.LittleEndian.Uint32(d[12:])
+				h.sizeSource = sizeDescriptor
+				return
+			}
+			// The signature is part of the data.
+			from = next + 1
+			continue
+		}
+		// No signature, so the descriptor is right before the next
+		// structure.
+		end := next - 12
+		if end < h.pos {
+			from = next + 1
+			continue
+		}
+		if _, err := r.ReadAt(d[:12], end); err == nil && int64(binary.LittleEndian.Uint32(d[4:])) == end-h.pos {
+			h.crc32 = binary.LittleEndian.Uint32(d[0:])
+			h.csize = binary.LittleEndian.Uint32(d[4:])
+			h.size = binary.LittleEndian.Uint32(d[8:])
+			h.sizeSource = sizeDescriptor
+			return
+		}
+		h.csize = uint32(end - h.pos)
+		h.sizeSource = sizeInferred
+		return
+	}
+}
+
+// recoverZeroSizes infers the sizes of an entry without a data descriptor
+// that declares zero sizes although data follows its header, as written by
+// some streaming tools. The data is taken to reach up to the next
+// structure, which gives the size of stored entries too.
+func recoverZeroSizes(r io.ReaderAt, h *FileHeader, size int64) {
+	if strings.HasSuffix(h.name, "/") {
+		return
+	}
+	if c := h.central; c != nil && c.csize != 0 {
+		h.crc32, h.csize, h.size = c.crc32, c.csize, c.size
+		h.sizeSource = sizeCentral
+		return
+	}
+	next, _, ok := findNextStructure(r, h.pos, size)
+	if !ok || next == h.pos {
+		return
+	}
+	h.csize = uint32(next - h.pos)
+	if h.compression == 0 {
+		h.size = h.csize
+	}
+	h.sizeSource = sizeInferred
+	h.warnings = append(h.warnings, fmt.Sprintf("sizes declared zero, inferred %d bytes of data up to the next structure", h.csize))
+}
+
+// descriptorLen returns the length of the data descriptor following the
+// data of h, if it has one.
+func descriptorLen(r io.ReaderAt, h *FileHeader) int64 {
+	if h.flags&0x8 == 0 {
+		return 0
+	}
+	var sig [4]byte
+	if _, err := r.ReadAt(sig[:], h.pos+int64(h.csize)); err == nil && binary.LittleEndian.Uint32(sig[:]) == dataDescriptorSignature {
+		return 16
+	}
+	return 12
+}
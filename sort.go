@@ -0,0 +1,87 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// entryLess orders entries for -sort.
+var entryLess = map[string]func(a, b *FileHeader) bool{
+	"offset":     func(a, b *FileHeader) bool { return a.pos < b.pos },
+	"name":       func(a, b *FileHeader) bool { return a.name < b.name },
+	"size":       func(a, b *FileHeader) bool { return a.size < b.size },
+	"ratio":      func(a, b *FileHeader) bool { return ratio(a) < ratio(b) },
+	"central":    func(a, b *FileHeader) bool { return centralIndex(a) < centralIndex(b) },
+	"confidence": func(a, b *FileHeader) bool { return a.confidence < b.confidence },
+}
+
+// centralIndex is the position of h in the central directory, entries it
+// doesn't list come last.
+func centralIndex(h *FileHeader) int {
+	if h.central == nil {
+		return math.MaxInt
+	}
+	return h.central.index
+}
+
+// ratio is how many times the content of h expands when decompressed.
+func ratio(h *FileHeader) float64 {
+	if h.csize == 0 {
+		return 0
+	}
+	return float64(h.size) / float64(h.csize)
+}
+
+// sortingReporter buffers all entries and passes them on to rep sorted
+// once the scan is done.
+type sortingReporter struct {
+	rep     reporter
+	less    func(a, b *FileHeader) bool
+	reverse bool
+	entries []*FileHeader
+}
+
+func newSortingReporter(rep reporter, key string, reverse bool) (*sortingReporter, error) {
+	less, ok := entryLess[key]
+	if !ok {
+		return nil, fmt.Errorf("invalid -sort %q, want offset, name, size, ratio, confidence or central", key)
+	}
+	return &sortingReporter{rep: rep, less: less, reverse: reverse}, nil
+}
+
+func (r *sortingReporter) entry(h *FileHeader) error {
+	c := *h
+	r.entries = append(r.entries, &c)
+	return nil
+}
+
+func (r *sortingReporter) summary(s *Summary) error {
+	sort.SliceStable(r.entries, func(i, j int) bool {
+		if r.reverse {
+			return r.less(r.entries[j], r.entries[i])
+		}
+		return r.less(r.entries[i], r.entries[j])
+	})
+	for _, h := range r.entries {
+		if err := r.rep.entry(h); err != nil {
+			return err
+		}
+	}
+	r.entries = nil
+	return r.rep.summary(s)
+}
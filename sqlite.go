@@ -0,0 +1,376 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The database written by -sqlite, in the SQLite file format, see
+// https://www.sqlite.org/fileformat.html. The file is written in one go
+// once all scans are done, which needs no SQLite library: every table is a
+// b-tree of leaf pages holding the rows and interior pages above them.
+const (
+	sqlitePageSize = 4096
+	// sqliteVersion is the SQLite version the file claims to be written
+	// by, 3.45.0.
+	sqliteVersion = 3045000
+
+	sqliteLeafTable     = 0x0d
+	sqliteInteriorTable = 0x05
+)
+
+const sqliteEntriesTable = `CREATE TABLE entries(file TEXT, offset INTEGER, header_offset INTEGER, name TEXT, size INTEGER, csize INTEGER, crc32 INTEGER, method INTEGER, flags INTEGER, modified TEXT, class TEXT, hidden INTEGER, confidence INTEGER, sha256 TEXT, warnings TEXT)`
+
+const sqliteArchivesTable = `CREATE TABLE archives(file TEXT, entries INTEGER, hidden INTEGER, phantom INTEGER, chained INTEGER, size INTEGER, accounted INTEGER, first_header INTEGER, eocd INTEGER, container TEXT, reason TEXT, error TEXT, warnings TEXT)`
+
+// sqliteDB collects the entries and archive summaries of all scans for
+// -sqlite. It is safe for concurrent use.
+type sqliteDB struct {
+	w io.Writer
+
+	mu       sync.Mutex
+	entries  [][]byte
+	archives [][]byte
+}
+
+// reporter returns a reporter that adds the entries and summary of
+// filename to the database, then passes them on to rep.
+func (d *sqliteDB) reporter(rep reporter, filename string) reporter {
+	return &sqliteReporter{rep: rep, db: d, file: filename}
+}
+
+type sqliteReporter struct {
+	rep     reporter
+	db      *sqliteDB
+	file    string
+	entries [][]byte
+}
+
+func (r *sqliteReporter) entry(h *FileHeader) error {
+	var modified any
+	if !h.modTime.IsZero() {
+		modified = h.modTime.Format(time.RFC3339)
+	}
+	r.entries = append(r.entries, sqliteRecord(r.file, h.pos, h.headerPos(), h.name,
+		int64(h.size), int64(h.csize), int64(h.crc32), int64(h.compression), int64(h.flags),
+		modified, h.class, sqliteBool(h.hidden), int64(h.confidence), sqliteText(h.hash),
+		sqliteText(strings.Join(h.warnings, "; "))))
+	return r.rep.entry(h)
+}
+
+func (r *sqliteReporter) summary(s *Summary) error {
+	var first, eocd any
+	if s.FirstHeader != nil {
+		first = *s.FirstHeader
+	}
+	if s.EOCD != nil {
+		eocd = *s.EOCD
+	}
+	archive := sqliteRecord(r.file, int64(s.Entries), int64(s.Hidden), int64(s.Phantom),
+		int64(s.Chained), s.Size, s.Accounted, first, eocd, sqliteText(s.Container),
+		s.Reason, sqliteText(s.Error), sqliteText(strings.Join(s.Warnings, "; ")))
+	// Entries of a file stay together even with concurrent scans.
+	r.db.mu.Lock()
+	r.db.entries = append(r.db.entries, r.entries...)
+	r.db.archives = append(r.db.archives, archive)
+	r.db.mu.Unlock()
+	r.entries = nil
+	return r.rep.summary(s)
+}
+
+// sqliteText stores empty strings as NULL.
+func sqliteText(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func sqliteBool(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// close writes the database.
+func (d *sqliteDB) close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var f sqliteFile
+	// Page 1 holds the file header and the schema table.
+	f.pages = [][]byte{nil}
+	entries := f.table(d.entries)
+	archives := f.table(d.archives)
+	schema := [][]byte{
+		sqliteRecord("table", "entries", "entries", int64(entries), sqliteEntriesTable),
+		sqliteRecord("table", "archives", "archives", int64(archives), sqliteArchivesTable),
+	}
+	var cells [][]byte
+	for i, rec := range schema {
+		cells = append(cells, f.leafCell(int64(i+1), rec))
+	}
+	f.pages[0] = sqlitePage(sqliteLeafTable, cells, 0, 100)
+	f.header()
+	for _, p := range f.pages {
+		if _, err := d.w.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteFile holds the pages of a database being built. Page n is
+// pages[n-1].
+type sqliteFile struct {
+	pages [][]byte
+}
+
+// add appends page and returns its number.
+func (f *sqliteFile) add(page []byte) uint32 {
+	f.pages = append(f.pages, page)
+	return uint32(len(f.pages))
+}
+
+// header fills in the database header on page 1.
+func (f *sqliteFile) header() {
+	h := f.pages[0]
+	copy(h, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(h[16:], sqlitePageSize)
+	h[18], h[19] = 1, 1 // legacy journal mode
+	h[21], h[22], h[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(h[24:], 1) // file change counter
+	binary.BigEndian.PutUint32(h[28:], uint32(len(f.pages)))
+	binary.BigEndian.PutUint32(h[40:], 1) // schema cookie
+	binary.BigEndian.PutUint32(h[44:], 4) // schema format
+	binary.BigEndian.PutUint32(h[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(h[92:], 1) // valid for change counter 1
+	binary.BigEndian.PutUint32(h[96:], sqliteVersion)
+}
+
+// table writes a table b-tree holding records with rowids from 1 and
+// returns its root page.
+func (f *sqliteFile) table(records [][]byte) uint32 {
+	type child struct {
+		page   uint32
+		maxRow int64
+	}
+	var level []child
+	var cells [][]byte
+	used := 8
+	flush := func(maxRow int64) {
+		level = append(level, child{f.add(sqlitePage(sqliteLeafTable, cells, 0, 0)), maxRow})
+		cells, used = nil, 8
+	}
+	for i, rec := range records {
+		cell := f.leafCell(int64(i+1), rec)
+		if used+2+len(cell) > sqlitePageSize {
+			flush(int64(i))
+		}
+		cells = append(cells, cell)
+		used += 2 + len(cell)
+	}
+	if cells != nil || level == nil {
+		flush(int64(len(records)))
+	}
+	// Interior pages point to their children by the largest rowid in
+	// each, the last child is the right-most pointer.
+	for len(level) > 1 {
+		var next []child
+		for len(level) > 0 {
+			used, n := 12, 1
+			for n < len(level) {
+				cellLen := 4 + sqliteVarintLen(uint64(level[n-1].maxRow))
+				if used+2+cellLen > sqlitePageSize {
+					break
+				}
+				used += 2 + cellLen
+				n++
+			}
+			var cells [][]byte
+			for _, c := range level[:n-1] {
+				cell := appendUint32(nil, c.page)
+				cells = append(cells, appendSQLiteVarint(cell, uint64(c.maxRow)))
+			}
+			last := level[n-1]
+			next = append(next, child{f.add(sqlitePage(sqliteInteriorTable, cells, last.page, 0)), last.maxRow})
+			level = level[n:]
+		}
+		level = next
+	}
+	return level[0].page
+}
+
+// leafCell returns the cell of a table leaf page holding rec, moving what
+// doesn't fit to overflow pages.
+func (f *sqliteFile) leafCell(rowid int64, rec []byte) []byte {
+	const (
+		usable   = sqlitePageSize
+		maxLocal = usable - 35
+		minLocal = (usable-12)*32/255 - 23
+	)
+	cell := appendSQLiteVarint(nil, uint64(len(rec)))
+	cell = appendSQLiteVarint(cell, uint64(rowid))
+	if len(rec) <= maxLocal {
+		return append(cell, rec...)
+	}
+	local := minLocal + (len(rec)-minLocal)%(usable-4)
+	if local > maxLocal {
+		local = minLocal
+	}
+	cell = append(cell, rec[:local]...)
+	// Overflow pages are chained by their first four bytes and written
+	// back to front, so each knows the next.
+	rest := rec[local:]
+	var chunks [][]byte
+	for len(rest) > 0 {
+		n := len(rest)
+		if n > usable-4 {
+			n = usable - 4
+		}
+		chunks = append(chunks, rest[:n])
+		rest = rest[n:]
+	}
+	next := uint32(0)
+	for i := len(chunks) - 1; i >= 0; i-- {
+		page := make([]byte, sqlitePageSize)
+		binary.BigEndian.PutUint32(page, next)
+		copy(page[4:], chunks[i])
+		next = f.add(page)
+	}
+	return appendUint32(cell, next)
+}
+
+// appendUint32 appends v in big-endian byte order.
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// sqlitePage lays out a b-tree page with the given cells, its header at
+// offset off. right is the right-most pointer of interior pages.
+func sqlitePage(kind byte, cells [][]byte, right uint32, off int) []byte {
+	page := make([]byte, sqlitePageSize)
+	page[off] = kind
+	ptrs := off + 8
+	if kind == sqliteInteriorTable {
+		binary.BigEndian.PutUint32(page[off+8:], right)
+		ptrs += 4
+	}
+	binary.BigEndian.PutUint16(page[off+3:], uint16(len(cells)))
+	content := sqlitePageSize
+	for i, c := range cells {
+		content -= len(c)
+		copy(page[content:], c)
+		binary.BigEndian.PutUint16(page[ptrs+2*i:], uint16(content))
+	}
+	binary.BigEndian.PutUint16(page[off+5:], uint16(content))
+	return page
+}
+
+// sqliteRecord encodes values, which are nil, int64 or string, in the
+// record format.
+func sqliteRecord(values ...any) []byte {
+	var types, body []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			types = appendSQLiteVarint(types, 0)
+		case string:
+			types = appendSQLiteVarint(types, uint64(2*len(v)+13))
+			body = append(body, v...)
+		case int64:
+			t, n := sqliteIntType(v)
+			types = appendSQLiteVarint(types, t)
+			for i := n - 1; i >= 0; i-- {
+				body = append(body, byte(v>>(8*i)))
+			}
+		default:
+			panic(fmt.Sprintf("sqliteRecord: unsupported %T", v))
+		}
+	}
+	// The header size includes its own varint.
+	n := 1
+	for sqliteVarintLen(uint64(len(types)+n)) != n {
+		n++
+	}
+	rec := appendSQLiteVarint(nil, uint64(len(types)+n))
+	rec = append(rec, types...)
+	return append(rec, body...)
+}
+
+// sqliteIntType returns the serial type of v and its size in bytes.
+func sqliteIntType(v int64) (uint64, int) {
+	switch {
+	case v == 0:
+		return 8, 0
+	case v == 1:
+		return 9, 0
+	case v >= -1<<7 && v < 1<<7:
+		return 1, 1
+	case v >= -1<<15 && v < 1<<15:
+		return 2, 2
+	case v >= -1<<23 && v < 1<<23:
+		return 3, 3
+	case v >= -1<<31 && v < 1<<31:
+		return 4, 4
+	case v >= -1<<47 && v < 1<<47:
+		return 5, 6
+	}
+	return 6, 8
+}
+
+// appendSQLiteVarint appends v as a SQLite varint: big-endian groups of
+// seven bits with the high bit marking continuation, the ninth byte
+// holding eight bits.
+func appendSQLiteVarint(b []byte, v uint64) []byte {
+	if v > 1<<56-1 {
+		var buf [9]byte
+		buf[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(b, buf[:]...)
+	}
+	var buf [8]byte
+	n := 0
+	for {
+		buf[n] = byte(v & 0x7f)
+		n++
+		v >>= 7
+		if v == 0 {
+			break
+		}
+	}
+	for i := n - 1; i >= 0; i-- {
+		c := buf[i]
+		if i > 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+func sqliteVarintLen(v uint64) int {
+	return len(appendSQLiteVarint(nil, v))
+}
@@ -0,0 +1,301 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The tests read back what sqliteDB writes with a reader of their own,
+// following https://www.sqlite.org/fileformat.html independently of the
+// writer.
+
+// readSQLiteVarint decodes the varint at the start of b and returns it with
+// its length.
+func readSQLiteVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return v<<8 | uint64(b[8]), 9
+}
+
+func TestSQLiteVarint(t *testing.T) {
+	for _, tc := range []struct {
+		v uint64
+		n int
+	}{
+		{0, 1}, {127, 1}, {128, 2}, {1<<14 - 1, 2}, {1 << 14, 3},
+		{1<<56 - 1, 8}, {1 << 56, 9}, {1<<63 + 12345, 9}, {1<<64 - 1, 9},
+	} {
+		b := appendSQLiteVarint(nil, tc.v)
+		if len(b) != tc.n || sqliteVarintLen(tc.v) != tc.n {
+			t.Errorf("%d takes %d bytes, want %d", tc.v, len(b), tc.n)
+		}
+		if v, n := readSQLiteVarint(b); v != tc.v || n != len(b) {
+			t.Errorf("%d reads back as %d from %d bytes", tc.v, v, n)
+		}
+	}
+}
+
+// sqliteTestFile reads a database as written by sqliteDB.
+type sqliteTestFile struct {
+	t        *testing.T
+	b        []byte
+	pageSize int
+	// overflowPages and interiorPages count what the table walks ran
+	// into, depth is the deepest b-tree seen.
+	overflowPages, interiorPages, depth int
+}
+
+func (f *sqliteTestFile) page(n uint32) []byte {
+	if n == 0 || int(n)*f.pageSize > len(f.b) {
+		f.t.Fatalf("page %d is out of range", n)
+	}
+	return f.b[int(n-1)*f.pageSize : int(n)*f.pageSize]
+}
+
+// rows returns the records of the table with the given root page, checking
+// that the rowids ascend from 1.
+func (f *sqliteTestFile) rows(root uint32) [][]any {
+	var rows [][]any
+	f.walk(root, 1, func(rowid int64, rec []byte) {
+		if rowid != int64(len(rows)+1) {
+			f.t.Fatalf("row %d has rowid %d", len(rows)+1, rowid)
+		}
+		rows = append(rows, f.record(rec))
+	})
+	return rows
+}
+
+func (f *sqliteTestFile) walk(n uint32, depth int, fn func(int64, []byte)) {
+	if depth > f.depth {
+		f.depth = depth
+	}
+	page := f.page(n)
+	off := 0
+	if n == 1 {
+		off = 100
+	}
+	cells := int(binary.BigEndian.Uint16(page[off+3:]))
+	switch page[off] {
+	case 0x05:
+		f.interiorPages++
+		for i := 0; i < cells; i++ {
+			cell := page[binary.BigEndian.Uint16(page[off+12+2*i:]):]
+			f.walk(binary.BigEndian.Uint32(cell), depth+1, fn)
+		}
+		f.walk(binary.BigEndian.Uint32(page[off+8:]), depth+1, fn)
+	case 0x0d:
+		for i := 0; i < cells; i++ {
+			cell := page[binary.BigEndian.Uint16(page[off+8+2*i:]):]
+			size, n := readSQLiteVarint(cell)
+			rowid, m := readSQLiteVarint(cell[n:])
+			fn(int64(rowid), f.payload(cell[n+m:], int(size)))
+		}
+	default:
+		f.t.Fatalf("page %d has type %#x", n, page[off])
+	}
+}
+
+// payload collects the size bytes of a leaf cell payload starting at b,
+// following the overflow pages.
+func (f *sqliteTestFile) payload(b []byte, size int) []byte {
+	u := f.pageSize
+	x := u - 35
+	if size <= x {
+		return b[:size]
+	}
+	m := (u-12)*32/255 - 23
+	local := m + (size-m)%(u-4)
+	if local > x {
+		local = m
+	}
+	rec := append([]byte(nil), b[:local]...)
+	next := binary.BigEndian.Uint32(b[local:])
+	for len(rec) < size {
+		f.overflowPages++
+		page := f.page(next)
+		n := size - len(rec)
+		if n > u-4 {
+			n = u - 4
+		}
+		rec = append(rec, page[4:4+n]...)
+		next = binary.BigEndian.Uint32(page)
+	}
+	if next != 0 {
+		f.t.Fatalf("overflow chain goes on past the end of the payload")
+	}
+	return rec
+}
+
+// record decodes a record into nil, int64 and string values.
+func (f *sqliteTestFile) record(rec []byte) []any {
+	hlen, n := readSQLiteVarint(rec)
+	types, body := rec[n:hlen], rec[hlen:]
+	var values []any
+	for len(types) > 0 {
+		typ, n := readSQLiteVarint(types)
+		types = types[n:]
+		switch {
+		case typ == 0:
+			values = append(values, nil)
+		case typ == 8, typ == 9:
+			values = append(values, int64(typ-8))
+		case typ >= 1 && typ <= 6:
+			size := []int{1, 2, 3, 4, 6, 8}[typ-1]
+			v := int64(int8(body[0]))
+			for _, c := range body[1:size] {
+				v = v<<8 | int64(c)
+			}
+			values = append(values, v)
+			body = body[size:]
+		case typ >= 13 && typ%2 == 1:
+			size := int(typ-13) / 2
+			values = append(values, string(body[:size]))
+			body = body[size:]
+		default:
+			f.t.Fatalf("unexpected serial type %d", typ)
+		}
+	}
+	if len(body) != 0 {
+		f.t.Fatalf("record has %d bytes left over", len(body))
+	}
+	return values
+}
+
+// testSQLiteDB writes a database of n entries of file a.zip, the warnings
+// of entry i being warning(i), and returns it.
+func testSQLiteDB(t *testing.T, n int, warning func(int) string) []byte {
+	var buf bytes.Buffer
+	db := &sqliteDB{w: &buf}
+	rep := db.reporter(&collector{}, "a.zip")
+	for i := 0; i < n; i++ {
+		h := &FileHeader{name: fmt.Sprintf("%d.txt", i), pos: int64(i) << 40, size: uint32(i), class: classHidden, hidden: true}
+		if w := warning(i); w != "" {
+			h.warnings = []string{w}
+		}
+		if err := rep.entry(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rep.summary(&Summary{Entries: n, Reason: reasonEOF}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// checkSQLiteDB reads b back, checking its header, schema and the rows of
+// a database from testSQLiteDB.
+func checkSQLiteDB(t *testing.T, b []byte, n int, warning func(int) string) *sqliteTestFile {
+	t.Helper()
+	if !bytes.HasPrefix(b, []byte("SQLite format 3\x00")) {
+		t.Fatal("no SQLite header")
+	}
+	f := &sqliteTestFile{t: t, b: b, pageSize: int(binary.BigEndian.Uint16(b[16:]))}
+	if len(b)%f.pageSize != 0 || int(binary.BigEndian.Uint32(b[28:])) != len(b)/f.pageSize {
+		t.Fatalf("header claims %d pages, file has %d bytes", binary.BigEndian.Uint32(b[28:]), len(b))
+	}
+	roots := make(map[string]uint32)
+	for _, row := range f.rows(1) {
+		if row[0] != "table" || !strings.HasPrefix(row[4].(string), "CREATE TABLE "+row[1].(string)+"(") {
+			t.Fatalf("unexpected schema row %q", row)
+		}
+		roots[row[1].(string)] = uint32(row[3].(int64))
+	}
+	rows := f.rows(roots["entries"])
+	if len(rows) != n {
+		t.Fatalf("entries has %d rows, want %d", len(rows), n)
+	}
+	for i, row := range rows {
+		var w any
+		if s := warning(i); s != "" {
+			w = s
+		}
+		if row[0] != "a.zip" || row[1] != int64(i)<<40 || row[3] != fmt.Sprintf("%d.txt", i) ||
+			row[4] != int64(i) || row[10] != classHidden || row[11] != int64(1) || row[14] != w {
+			t.Fatalf("row %d is %q", i+1, row)
+		}
+	}
+	archives := f.rows(roots["archives"])
+	if len(archives) != 1 || archives[0][0] != "a.zip" || archives[0][1] != int64(n) {
+		t.Fatalf("archives has %q", archives)
+	}
+	return f
+}
+
+func TestSQLiteSmall(t *testing.T) {
+	none := func(int) string { return "" }
+	f := checkSQLiteDB(t, testSQLiteDB(t, 3, none), 3, none)
+	if f.interiorPages != 0 || f.overflowPages != 0 {
+		t.Errorf("three rows take %d interior and %d overflow pages", f.interiorPages, f.overflowPages)
+	}
+	checkSQLiteDB(t, testSQLiteDB(t, 0, none), 0, none)
+}
+
+func TestSQLitePages(t *testing.T) {
+	// About two rows fit on a leaf page, so 1500 rows need more leaves
+	// than an interior page can point to and the interior level splits.
+	// Every hundredth row spills into overflow pages.
+	warning := func(i int) string {
+		if i%100 == 0 {
+			return strings.Repeat(fmt.Sprint(i%10), 10000+i)
+		}
+		return strings.Repeat("w", 1500)
+	}
+	const n = 1500
+	b := testSQLiteDB(t, n, warning)
+	f := checkSQLiteDB(t, b, n, warning)
+	if f.depth < 3 || f.interiorPages < 3 {
+		t.Errorf("b-tree of depth %d with %d interior pages, want a split interior level", f.depth, f.interiorPages)
+	}
+	if f.overflowPages < 2*n/100 {
+		t.Errorf("%d overflow pages, want at least two per long row", f.overflowPages)
+	}
+
+	// Let SQLite itself check the file, if it is around.
+	sqlite, err := exec.LookPath("sqlite3")
+	if err != nil {
+		t.Skip("no sqlite3 to check the database with")
+	}
+	name := filepath.Join(t.TempDir(), "a.db")
+	if err := os.WriteFile(name, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(sqlite, name, "PRAGMA integrity_check; SELECT count(*), sum(length(warnings)) FROM entries;").CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	var sum int
+	for i := 0; i < n; i++ {
+		sum += len(warning(i))
+	}
+	if want := fmt.Sprintf("ok\n%d|%d\n", n, sum); string(out) != want {
+		t.Errorf("sqlite3 says %q, want %q", out, want)
+	}
+}
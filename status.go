@@ -0,0 +1,93 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// statusReporter notes what the exit status depends on: whether any entry
+// was reported, for -only, and whether an input wasn't a zip at all. It is
+// safe for concurrent use.
+type statusReporter struct {
+	reporter
+	st *runStatus
+}
+
+// runStatus is shared by the statusReporters of a run. flagged is set by
+// the verdictReporters.
+type runStatus struct {
+	matched, notZip, flagged int32
+}
+
+func (r *statusReporter) entry(h *FileHeader) error {
+	atomic.StoreInt32(&r.st.matched, 1)
+	return r.reporter.entry(h)
+}
+
+func (r *statusReporter) summary(s *Summary) error {
+	if s.Reason == reasonNotZip {
+		atomic.StoreInt32(&r.st.notZip, 1)
+	}
+	return r.reporter.summary(s)
+}
+
+// Verdicts of -summary-only.
+const (
+	verdictClean      = "clean"
+	verdictSuspicious = "suspicious"
+	verdictHidden     = "hidden-found"
+)
+
+// verdictReporter prints one tab-separated line per input for
+// -summary-only: path, entries, hidden entries, suspicious entries and the
+// verdict. Inputs with hidden entries are hidden-found, those with other
+// suspicious entries, phantom ones or warnings suspicious. Inputs that
+// aren't clean are noted in st for the exit status.
+type verdictReporter struct {
+	w          io.Writer
+	file       string
+	st         *runStatus
+	suspicious int
+}
+
+func (r *verdictReporter) entry(h *FileHeader) error {
+	if onlyFilters["suspicious"](h) {
+		r.suspicious++
+	}
+	return nil
+}
+
+func (r *verdictReporter) summary(s *Summary) error {
+	var verdict string
+	switch {
+	case s.Reason == reasonError || s.Reason == reasonNotZip:
+		verdict = s.Reason
+	case s.Hidden > 0:
+		verdict = verdictHidden
+	case r.suspicious > 0 || s.Phantom > 0 || len(s.Warnings) > 0:
+		verdict = verdictSuspicious
+	default:
+		verdict = verdictClean
+	}
+	if verdict == verdictHidden || verdict == verdictSuspicious {
+		atomic.StoreInt32(&r.st.flagged, 1)
+	}
+	_, err := fmt.Fprintf(r.w, "%s\t%d\t%d\t%d\t%s\n", r.file, s.Entries, s.Hidden, r.suspicious, verdict)
+	r.suspicious = 0
+	return err
+}
@@ -0,0 +1,83 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"io"
+	"path"
+	"strings"
+)
+
+// isTar reports whether r starts with a ustar header.
+func isTar(r io.ReaderAt) bool {
+	var magic [5]byte
+	_, err := r.ReadAt(magic[:], 257)
+	return err == nil && string(magic[:]) == "ustar"
+}
+
+// scanTarMembers scans every member of the tar archive in f that looks like
+// a zip. Entries are reported as "file.tar/member.zip!entry".
+func scanTarMembers(f readSeekerAt, filename string, cfg *config, rep reporter, s *Summary) error {
+	// Offsets within members don't relate to the tar file.
+	mcfg := *cfg
+	mcfg.start, mcfg.checkpoint, mcfg.skip = 0, nil, 0
+	tr := tar.NewReader(f)
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if th.Typeflag != tar.TypeReg {
+			continue
+		}
+		br := bufio.NewReader(tr)
+		head, _ := br.Peek(4)
+		if !looksLikeZip(th.Name, head) {
+			continue
+		}
+		// tar readers can't seek, so members are buffered like stdin.
+		member, cleanup, err := bufferInput(br, cfg.spill)
+		if err != nil {
+			return err
+		}
+		var ms Summary
+		container := path.Base(filename) + "/" + th.Name
+		err = scanFileHeaders(member, &mcfg, &prefixReporter{rep, container}, &ms)
+		cleanup()
+		s.merge(&ms, container+"!")
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// looksLikeZip guesses from its name and first bytes whether a file is a
+// zip archive.
+func looksLikeZip(name string, head []byte) bool {
+	if bytes.HasPrefix(head, []byte("PK\x03\x04")) || bytes.HasPrefix(head, []byte("PK\x05\x06")) {
+		return true
+	}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".zip", ".jar", ".apk":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// tarWriter writes the decompressed content of entries to a tar archive.
+// It is safe for concurrent use.
+type tarWriter struct {
+	spill spill
+
+	mu    sync.Mutex
+	tw    *tar.Writer
+	names uniqueNames
+}
+
+func newTarWriter(w io.Writer, sp spill) *tarWriter {
+	return &tarWriter{spill: sp, tw: tar.NewWriter(w), names: make(uniqueNames)}
+}
+
+func (t *tarWriter) write(h *FileHeader) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Names are made safe like for -extract, or the tar could write
+	// outside the directory it is unpacked in.
+	name := t.names.get(sanitizeName(h.name))
+	if strings.HasSuffix(name, "/") {
+		return t.tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     name,
+			Mode:     0755,
+			ModTime:  h.modTime,
+		})
+	}
+
+	rc, err := openEntry(h.src, h)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	// The declared size may be wrong, and tar needs the real one upfront.
+	content, cleanup, err := bufferInput(rc, t.spill)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	err = t.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  h.modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(t.tw, content)
+	return err
+}
+
+// uniqueNames hands out names, adding a numeric suffix to names that were
+// used before.
+type uniqueNames map[string]int
+
+func (u uniqueNames) get(name string) string {
+	n := u[name]
+	u[name] = n + 1
+	if n == 0 {
+		return name
+	}
+	if dir := strings.TrimSuffix(name, "/"); dir != name {
+		return fmt.Sprintf("%s.%d/", dir, n)
+	}
+	return fmt.Sprintf("%s.%d", name, n)
+}
+
+// close finishes the tar archive.
+func (t *tarWriter) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tw.Close()
+}
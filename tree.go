@@ -0,0 +1,187 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// treeNode is an entry in the hierarchy of nested scans. Containers that
+// aren't entries themselves, like the members of a tar file, have no
+// header.
+type treeNode struct {
+	h        *FileHeader
+	name     string
+	children []*treeNode
+}
+
+// treeReporter arranges the entries of nested scans by their chain of
+// containers into a tree that is written once the scan is done,
+// followed by per-level statistics. Text output is indented, JSON output
+// nests entries under "children".
+type treeReporter struct {
+	w    io.Writer
+	text *textReporter
+	// json selects JSON output, with pretty indenting it. prefix is
+	// written before the JSON document.
+	json, pretty bool
+	file, prefix string
+
+	root treeNode
+	// byPath finds nodes by their chain of container names followed by
+	// their own, joined by treePathSep.
+	byPath map[string]*treeNode
+}
+
+// treePathSep joins the names of a tree path. Unlike the "!" of displayed
+// names, it can't appear in entry names.
+const treePathSep = "\x00"
+
+// treeLevel counts the entries at one nesting depth.
+type treeLevel struct {
+	Depth   int `json:"depth"`
+	Entries int `json:"entries"`
+	Hidden  int `json:"hidden"`
+}
+
+func (t *treeReporter) entry(h *FileHeader) error {
+	c := *h
+	// The displayed name is the chain joined by "!", which is only
+	// stripped, never split at.
+	name := h.name
+	for _, container := range h.containers {
+		name = strings.TrimPrefix(name, container+"!")
+	}
+	parent := t.node(h.containers)
+	n := &treeNode{h: &c, name: name}
+	parent.children = append(parent.children, n)
+	t.add(append(append([]string(nil), h.containers...), name), n)
+	return nil
+}
+
+// node returns the node at path, creating container nodes for the parts
+// that aren't entries.
+func (t *treeReporter) node(path []string) *treeNode {
+	if len(path) == 0 {
+		return &t.root
+	}
+	if n, ok := t.byPath[strings.Join(path, treePathSep)]; ok {
+		return n
+	}
+	parent := t.node(path[:len(path)-1])
+	n := &treeNode{name: path[len(path)-1]}
+	parent.children = append(parent.children, n)
+	t.add(path, n)
+	return n
+}
+
+func (t *treeReporter) add(path []string, n *treeNode) {
+	if t.byPath == nil {
+		t.byPath = make(map[string]*treeNode)
+	}
+	t.byPath[strings.Join(path, treePathSep)] = n
+}
+
+func (t *treeReporter) summary(s *Summary) error {
+	var levels []treeLevel
+	count := func(n *treeNode, depth int) {
+		if n.h == nil {
+			return
+		}
+		for len(levels) <= depth {
+			levels = append(levels, treeLevel{Depth: len(levels)})
+		}
+		levels[depth].Entries++
+		if n.h.class == classHidden {
+			levels[depth].Hidden++
+		}
+	}
+	if t.json {
+		return t.writeJSON(s, count, &levels)
+	}
+	if err := t.writeText(t.root.children, 0, count); err != nil {
+		return err
+	}
+	for _, l := range levels {
+		if _, err := fmt.Fprintf(t.w, "depth %d: %d entries, %d hidden\n", l.Depth, l.Entries, l.Hidden); err != nil {
+			return err
+		}
+	}
+	return t.text.summary(s)
+}
+
+func (t *treeReporter) writeText(nodes []*treeNode, depth int, count func(*treeNode, int)) error {
+	indent := strings.Repeat("  ", depth)
+	for _, n := range nodes {
+		count(n, depth)
+		var err error
+		if n.h == nil {
+			_, err = fmt.Fprintf(t.w, "%s%s/\n", indent, n.name)
+		} else if _, err = io.WriteString(t.w, indent); err == nil {
+			leaf := *n.h
+			leaf.name = n.name
+			err = t.text.entry(&leaf)
+		}
+		if err != nil {
+			return err
+		}
+		if err := t.writeText(n.children, depth+1, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonTreeNode is a node of the JSON tree. Container nodes only have a
+// name and children.
+type jsonTreeNode struct {
+	*jsonEntry
+	Name     string          `json:"name"`
+	Children []*jsonTreeNode `json:"children,omitempty"`
+}
+
+func (t *treeReporter) writeJSON(s *Summary, count func(*treeNode, int), levels *[]treeLevel) error {
+	var convert func(nodes []*treeNode, depth int) []*jsonTreeNode
+	convert = func(nodes []*treeNode, depth int) []*jsonTreeNode {
+		entries := []*jsonTreeNode{}
+		for _, n := range nodes {
+			count(n, depth)
+			e := &jsonTreeNode{Name: n.name}
+			if n.h != nil {
+				e.jsonEntry = newJSONEntry(n.h)
+			}
+			e.Children = convert(n.children, depth+1)
+			entries = append(entries, e)
+		}
+		return entries
+	}
+	tree := convert(t.root.children, 0)
+	if _, err := io.WriteString(t.w, t.prefix); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(t.w)
+	if t.pretty {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(struct {
+		File    string          `json:"file,omitempty"`
+		Tree    []*jsonTreeNode `json:"tree"`
+		Levels  []treeLevel     `json:"levels"`
+		Summary *Summary        `json:"summary"`
+	}{t.file, tree, *levels, s})
+}
@@ -0,0 +1,53 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestTreeNesting checks that the tree follows the chain of containers
+// instead of the "!" in names, which entries may contain themselves.
+func TestTreeNesting(t *testing.T) {
+	var out strings.Builder
+	cfg := newConfig(nil)
+	tree := &treeReporter{w: &out, text: &textReporter{w: &out, cfg: cfg}}
+	entry := func(rep reporter, name string) {
+		t.Helper()
+		if err := rep.entry(&FileHeader{name: name, class: classNormal, confidence: maxConfidence}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entry(tree, "a!b.txt")
+	entry(tree, "inner.zip")
+	entry(&prefixReporter{tree, "inner.zip"}, "c!d.txt")
+	entry(&prefixReporter{&prefixReporter{tree, "inner.zip"}, "x.tar/m.zip"}, "e.txt")
+	if err := tree.summary(&Summary{Reason: reasonEOF}); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, "depth ") {
+			break
+		}
+		fields := strings.Fields(line)
+		names = append(names, line[:strings.Index(line, fields[0])]+fields[0])
+	}
+	want := []string{"a!b.txt", "inner.zip", "  c!d.txt", "  x.tar/m.zip/", "    e.txt"}
+	if strings.Join(names, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got tree\n%s\nwant\n%s", strings.Join(names, "\n"), strings.Join(want, "\n"))
+	}
+}
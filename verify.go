@@ -0,0 +1,128 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// manifestEntry holds the fields of an entry that -verify checks. A
+// manifest is the output of -json or -json-pretty with -hash.
+type manifestEntry struct {
+	Name   string `json:"name"`
+	Offset int64  `json:"offset"`
+	Size   uint32 `json:"size"`
+	CRC32  uint32 `json:"crc32"`
+	SHA256 string `json:"sha256"`
+}
+
+// manifestRecord is a line of -json output or the -json-pretty document.
+type manifestRecord struct {
+	manifestEntry
+	Entries []manifestEntry `json:"entries"`
+	Summary json.RawMessage `json:"summary"`
+}
+
+// readManifest reads the entries of a manifest.
+func readManifest(filename string) ([]manifestEntry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []manifestEntry
+	d := json.NewDecoder(f)
+	for {
+		var r manifestRecord
+		if err := d.Decode(&r); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		if r.Entries != nil || r.Summary != nil {
+			entries = append(entries, r.Entries...)
+		} else {
+			entries = append(entries, r.manifestEntry)
+		}
+	}
+}
+
+// verifyManifest scans filename and compares its entries to those of the
+// manifest by name, reporting additions, removals and modifications to w.
+// It returns whether the archive drifted from the manifest.
+func verifyManifest(manifest []manifestEntry, filename string, cfg *config, w io.Writer) (bool, error) {
+	var scanned collector
+	if err := searchFileHeaders(filename, cfg, &scanned); err != nil {
+		return false, err
+	}
+	// Entries with the same name are matched in order.
+	byName := make(map[string][]int)
+	for i, m := range manifest {
+		byName[m.Name] = append(byName[m.Name], i)
+	}
+	matched := make([]bool, len(manifest))
+	var lines []string
+	for _, h := range scanned.headers {
+		idx := byName[h.name]
+		if len(idx) == 0 {
+			lines = append(lines, fmt.Sprintf("added %s at %d", h.name, h.pos))
+			continue
+		}
+		byName[h.name] = idx[1:]
+		matched[idx[0]] = true
+		if changes := entryChanges(manifest[idx[0]], &h); changes != nil {
+			lines = append(lines, fmt.Sprintf("modified %s: %s", h.name, strings.Join(changes, ", ")))
+		}
+	}
+	for i, m := range manifest {
+		if !matched[i] {
+			lines = append(lines, fmt.Sprintf("removed %s at %d", m.Name, m.Offset))
+		}
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return false, err
+		}
+	}
+	if lines == nil {
+		if _, err := fmt.Fprintf(w, "%d entries match the manifest\n", len(manifest)); err != nil {
+			return false, err
+		}
+	}
+	return lines != nil, nil
+}
+
+// entryChanges lists how h differs from the manifest entry m. Hashes are
+// only compared if both are known.
+func entryChanges(m manifestEntry, h *FileHeader) []string {
+	var changes []string
+	if m.Offset != h.pos {
+		changes = append(changes, fmt.Sprintf("offset %d -> %d", m.Offset, h.pos))
+	}
+	if m.Size != h.size {
+		changes = append(changes, fmt.Sprintf("size %d -> %d", m.Size, h.size))
+	}
+	if m.CRC32 != h.crc32 {
+		changes = append(changes, fmt.Sprintf("crc32 %08x -> %08x", m.CRC32, h.crc32))
+	}
+	if m.SHA256 != "" && h.hash != "" && m.SHA256 != h.hash {
+		changes = append(changes, fmt.Sprintf("sha256 %s -> %s", m.SHA256, h.hash))
+	}
+	return changes
+}
@@ -0,0 +1,127 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import "fmt"
+
+// hostSystems names the hosts of the "version made by" field.
+var hostSystems = map[uint16]string{
+	0: "MS-DOS", 1: "Amiga", 2: "OpenVMS", 3: "Unix", 4: "VM/CMS", 5: "Atari ST",
+	6: "OS/2 HPFS", 7: "Macintosh", 8: "Z-System", 9: "CP/M", 10: "NTFS", 11: "MVS",
+	12: "VSE", 13: "Acorn Risc", 14: "VFAT", 15: "alternate MVS", 16: "BeOS",
+	17: "Tandem", 18: "OS/400", 19: "OS X",
+}
+
+// requiredVersion returns the lowest version that can extract h according
+// to APPNOTE 4.4.3.2, with the feature that needs it.
+func requiredVersion(h *FileHeader) (uint16, string) {
+	v, feature := uint16(10), "stored data"
+	need := func(n uint16, f string) {
+		if n > v {
+			v, feature = n, f
+		}
+	}
+	switch h.compression {
+	case 1:
+		need(10, "shrinking")
+	case 2, 3, 4, 5:
+		need(10, "reducing")
+	case 6:
+		need(10, "imploding")
+	case 8:
+		need(20, "deflate")
+	case 9:
+		need(21, "deflate64")
+	case 10:
+		need(25, "PKWARE DCL implode")
+	case 12:
+		need(46, "bzip2")
+	case 14:
+		need(63, "LZMA")
+	case 93, 95:
+		need(63, fmt.Sprintf("compression method %d", h.compression))
+	case 98:
+		need(63, "PPMd")
+	case 99:
+		need(51, "AES encryption")
+	}
+	// APPNOTE asks for 2.0 for directories and traditional encryption too,
+	// but Info-ZIP writes 1.0 for both, so they don't count.
+	if _, ok := findExtra(h.extra, zip64ExtraID); ok {
+		need(45, "zip64")
+	}
+	if h.flags&0x40 != 0 {
+		need(50, "strong encryption")
+	}
+	return v, feature
+}
+
+// formatVersion formats the specification version of a version field, e.g.
+// 2.0 for 20.
+func formatVersion(v uint16) string {
+	v &= 0xff
+	return fmt.Sprintf("%d.%d", v/10, v%10)
+}
+
+// describeMadeBy interprets a "version made by" field.
+func describeMadeBy(v uint16) string {
+	host, ok := hostSystems[v>>8]
+	if !ok {
+		host = fmt.Sprintf("unknown host %d", v>>8)
+	}
+	return fmt.Sprintf("%s, zip %s", host, formatVersion(v))
+}
+
+// checkVersions warns about version fields that don't fit the features the
+// entry uses or each other, which hints at an archive repackaged by a
+// different tool than it claims. Versions above 6.3 are already reported
+// by classify.
+func checkVersions(h *FileHeader) {
+	needed := h.version & 0xff
+	if needed > 63 {
+		return
+	}
+	raw := fmt.Sprintf("raw needed 0x%04x", h.version)
+	if c := h.central; c != nil {
+		raw += fmt.Sprintf(", made by 0x%04x: %s", c.versionMadeBy, describeMadeBy(c.versionMadeBy))
+	}
+	warn := func(format string, args ...any) {
+		h.warnings = append(h.warnings, fmt.Sprintf(format, args...)+" ("+raw+")")
+	}
+	required, feature := requiredVersion(h)
+	switch {
+	case needed < required:
+		warn("version needed %s is below the %s that %s requires", formatVersion(needed), formatVersion(required), feature)
+	case needed >= 45 && required < 45:
+		// Tools pick 2.0 or the version of a feature they use, anything
+		// newer without such a feature is odd.
+		warn("version needed %s exceeds the %s its features require", formatVersion(needed), formatVersion(required))
+	}
+	c := h.central
+	if c == nil {
+		return
+	}
+	if c.versionNeeded != h.version {
+		warn("central directory needs version %s, the local header %s", formatVersion(c.versionNeeded), formatVersion(h.version))
+	}
+	if made := c.versionMadeBy & 0xff; made < needed {
+		warn("made by zip %s but needs %s to extract", formatVersion(made), formatVersion(needed))
+	} else if made > 63 {
+		warn("made by zip %s, beyond the specification", formatVersion(made))
+	}
+	if _, ok := hostSystems[c.versionMadeBy>>8]; !ok {
+		warn("made by unknown host %d", c.versionMadeBy>>8)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+)
+
+// visibleDataOffsets returns the data positions of the entries that
+// archive/zip lists for the archive in r, i.e. what a user extracting the
+// archive normally would see. If archive/zip can't open the archive at
+// all, that is unknown and the error says why.
+func visibleDataOffsets(r io.ReaderAt, size int64) (map[int64]bool, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("archive/zip: %w", err)
+	}
+	offsets := make(map[int64]bool, len(zr.File))
+	for _, f := range zr.File {
+		if pos, err := f.DataOffset(); err == nil {
+			offsets[pos] = true
+		}
+	}
+	return offsets, nil
+}
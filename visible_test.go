@@ -0,0 +1,94 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestVisibilityUnknown checks that entries aren't classed hidden just
+// because archive/zip can't open the input.
+func TestVisibilityUnknown(t *testing.T) {
+	archive := mustBuildFixture(t, selftestFiles)
+	r := bytes.NewReader(archive)
+	cd, err := readCentralDirectory(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without the central directory, archive/zip fails.
+	b := archive[:cd.pos]
+	res, err := Analyze(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Entries) != len(selftestFiles) {
+		t.Fatalf("found %d entries, want %d", len(res.Entries), len(selftestFiles))
+	}
+	for _, h := range res.Entries {
+		if h.hidden || h.class != classUnknown {
+			t.Errorf("%s: hidden %v, class %s, want unknown", h.name, h.hidden, h.class)
+		}
+	}
+	if res.Summary.Hidden != 0 || len(res.Summary.Warnings) == 0 {
+		t.Errorf("summary counts %d hidden entries with warnings %q, want none and a warning", res.Summary.Hidden, res.Summary.Warnings)
+	}
+}
+
+// TestHiddenCount checks that a hidden entry that is also phantom only
+// counts as the latter.
+func TestHiddenCount(t *testing.T) {
+	archive := mustBuildFixture(t, selftestFiles)
+	res, err := Analyze(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Summary.Hidden != 1 || res.Summary.Phantom != 0 {
+		t.Fatalf("summary counts %d hidden and %d phantom entries, want 1 and 0", res.Summary.Hidden, res.Summary.Phantom)
+	}
+	// An unknown compression method makes payload.bin phantom.
+	b := append([]byte(nil), archive...)
+	b[res.Entries[1].headerPos()+8] = 77
+	res, err = Analyze(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := res.Entries[1]; !h.hidden || h.class != classPhantom {
+		t.Fatalf("%s: hidden %v, class %s, want a hidden phantom", h.name, h.hidden, h.class)
+	}
+	if res.Summary.Hidden != 0 || res.Summary.Phantom != 1 {
+		t.Errorf("summary counts %d hidden and %d phantom entries, want 0 and 1", res.Summary.Hidden, res.Summary.Phantom)
+	}
+}
+
+// TestHiddenLabel checks that the text output labels hidden entries
+// without -v.
+func TestHiddenLabel(t *testing.T) {
+	var out strings.Builder
+	rep := &textReporter{w: &out, cfg: newConfig(nil)}
+	for _, h := range []*FileHeader{
+		{name: "shown.txt", class: classNormal, confidence: maxConfidence},
+		{name: "hidden.txt", hidden: true, class: classHidden, confidence: maxConfidence},
+	} {
+		if err := rep.entry(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || strings.HasSuffix(lines[0], " hidden") || !strings.HasSuffix(lines[1], " hidden") {
+		t.Errorf("only the second line should end in hidden:\n%s", out.String())
+	}
+}
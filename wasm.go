@@ -0,0 +1,42 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"syscall/js"
+)
+
+// main exposes scan(bytes) to JavaScript instead of running the command.
+// scan takes a Uint8Array with the file and returns an object with the
+// entries, gaps and summary, or with an error.
+func main() {
+	js.Global().Set("scan", js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) != 1 {
+			return map[string]any{"error": "usage: scan(Uint8Array)"}
+		}
+		b := make([]byte, args[0].Get("length").Int())
+		js.CopyBytesToGo(b, args[0])
+		out, err := json.Marshal(newJSONResult(Analyze(bytes.NewReader(b), int64(len(b)))))
+		if err != nil {
+			return map[string]any{"error": err.Error()}
+		}
+		return js.Global().Get("JSON").Call("parse", string(out))
+	}))
+	select {}
+}
@@ -0,0 +1,130 @@
+// Copyright 2022 Lukas Werling
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION
+// OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN
+// CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// errRuleDone stops the scan once yaraRule has written its rule.
+var errRuleDone = errors.New("rule written")
+
+// yaraRule writes a YARA rule for the first entry called name in filename
+// to w. It matches the raw local header of the entry or the first n bytes
+// of its decompressed content.
+func yaraRule(filename, name string, n int, cfg *config, w io.Writer) error {
+	f, release, err := openInput(filename, cfg.spill)
+	if err != nil {
+		return err
+	}
+	defer release()
+	rcfg := *cfg
+	rcfg.hash = true
+	var s Summary
+	err = scanFileHeaders(f, &rcfg, walkReporter(func(h FileHeader) error {
+		if h.name != name {
+			return nil
+		}
+		header := make([]byte, h.pos-h.headerPos())
+		if _, err := h.src.ReadAt(header, h.headerPos()); err != nil {
+			return err
+		}
+		var content []byte
+		if rc, err := openEntry(h.src, &h); err == nil {
+			content, _ = io.ReadAll(io.LimitReader(rc, int64(n)))
+			rc.Close()
+		}
+		if err := writeYARARule(w, filename, &h, header, content); err != nil {
+			return err
+		}
+		return errRuleDone
+	}), &s)
+	switch err {
+	case errRuleDone:
+		return nil
+	case nil:
+		return fmt.Errorf("%s: no entry %q", filename, name)
+	}
+	return fmt.Errorf("%s: %w", filename, err)
+}
+
+func writeYARARule(w io.Writer, filename string, h *FileHeader, header, content []byte) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "rule %s\n{\n", yaraIdentifier(h.name))
+	b.WriteString("    meta:\n")
+	fmt.Fprintf(&b, "        description = %s\n", yaraString("zip entry "+h.name+" found by hidden_zip"))
+	fmt.Fprintf(&b, "        source = %s\n", yaraString(filename))
+	fmt.Fprintf(&b, "        offset = %d\n", h.headerPos())
+	if h.hash != "" {
+		fmt.Fprintf(&b, "        sha256 = %s\n", yaraString(h.hash))
+	}
+	b.WriteString("    strings:\n")
+	fmt.Fprintf(&b, "        $header = { %s }\n", yaraHex(header))
+	condition := "$header"
+	if len(content) > 0 {
+		fmt.Fprintf(&b, "        $content = { %s }\n", yaraHex(content))
+		condition += " or $content"
+	}
+	fmt.Fprintf(&b, "    condition:\n        %s\n}\n", condition)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// yaraIdentifier turns an entry name into a rule identifier, which may only
+// contain letters, digits and underscores.
+func yaraIdentifier(name string) string {
+	id := []byte("hidden_zip_")
+	for i := 0; i < len(name) && len(id) < 128; i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+			id = append(id, c)
+		default:
+			id = append(id, '_')
+		}
+	}
+	return string(id)
+}
+
+// yaraString quotes s as a YARA text string.
+func yaraString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// yaraHex formats b as the bytes of a YARA hex string.
+func yaraHex(b []byte) string {
+	hex := make([]string, len(b))
+	for i, c := range b {
+		hex[i] = fmt.Sprintf("%02X", c)
+	}
+	return strings.Join(hex, " ")
+}